@@ -0,0 +1,47 @@
+package imgsz
+
+import (
+	"io"
+	"time"
+)
+
+// Animation describes the frames of an image. A still image has one frame,
+// no duration and plays once.
+type Animation struct {
+	Animated bool
+	Frames   int
+	// Duration is the time that one play of the animation takes, the sum
+	// of the delays of its frames.
+	Duration time.Duration
+	// LoopCount is the number of times that the animation plays, with 0
+	// meaning forever.
+	LoopCount int
+}
+
+// DecodeAnimation walks the whole of a GIF, PNG or WebP image to count its
+// frames and add up their delays, which DecodeInfo does not do. The string
+// returned is the format name.
+func DecodeAnimation(r io.Reader) (Animation, string, error) {
+	return defaultDecoder.DecodeAnimation(r)
+}
+
+// DecodeAnimation is like the DecodeAnimation function, for the formats of
+// d.
+func (d *Decoder) DecodeAnimation(r io.Reader) (Animation, string, error) {
+	rr, f, err := d.detect(r)
+	if err != nil {
+		return Animation{}, f.name, err
+	}
+	var anim Animation
+	switch f.name {
+	case "gif":
+		anim, err = gifAnimation(rr)
+	case "png":
+		anim, err = pngAnimation(rr)
+	case "webp":
+		anim, err = webpAnimation(rr)
+	default:
+		return Animation{}, f.name, UnsupportedError("animation scan of " + f.name)
+	}
+	return anim, f.name, err
+}
@@ -25,7 +25,40 @@ func readUint32(b []byte) uint32 {
 	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
 }
 
-func decodebmp(r io.Reader) (size Size, err error) {
+// dibHeader holds the fields of a BITMAPINFOHEADER, or of a later header
+// extending it, that describe the size and the pixel format.
+type dibHeader struct {
+	width, height          int
+	planes, bpp            uint16
+	compression, colorUsed uint32
+}
+
+// parseDIBHeader parses the DIB header in b, which starts with the length
+// of the header and is at least 40 bytes long. The height is made positive,
+// whatever the order of the rows.
+func parseDIBHeader(b []byte) dibHeader {
+	h := dibHeader{
+		width:       int(int32(readUint32(b[4:8]))),
+		height:      int(int32(readUint32(b[8:12]))),
+		planes:      readUint16(b[12:14]),
+		bpp:         readUint16(b[14:16]),
+		compression: readUint32(b[16:20]),
+		colorUsed:   readUint32(b[32:36]),
+	}
+	if h.height < 0 {
+		h.height = -h.height
+	}
+	// if compression is set to BI_BITFIELDS, but the bitmask is set to the default bitmask
+	// that would be used if compression was set to 0, we can continue as if compression was 0
+	if h.compression == 3 && len(b) >= 56 &&
+		readUint32(b[40:44]) == 0xff0000 && readUint32(b[44:48]) == 0xff00 &&
+		readUint32(b[48:52]) == 0xff && readUint32(b[52:56]) == 0xff000000 {
+		h.compression = 0
+	}
+	return h
+}
+
+func decodebmp(r io.Reader) (info Info, err error) {
 	// We only support those BMP images with one of the following DIB headers:
 	// - BITMAPINFOHEADER (40 bytes)
 	// - BITMAPV4HEADER (108 bytes)
@@ -41,59 +74,54 @@ func decodebmp(r io.Reader) (size Size, err error) {
 		if err == io.EOF {
 			err = io.ErrUnexpectedEOF
 		}
-		return Size{}, err
+		return Info{}, err
 	}
 	if string(b[:2]) != "BM" {
-		return Size{}, errors.New("bmp: invalid format")
+		return Info{}, errors.New("bmp: invalid format")
 	}
 	offset := readUint32(b[10:14])
 	infoLen := readUint32(b[14:18])
 	if infoLen != infoHeaderLen && infoLen != v4InfoHeaderLen && infoLen != v5InfoHeaderLen {
-		return Size{}, ErrUnsupported
+		return Info{}, ErrUnsupported
 	}
 	if _, err := io.ReadFull(r, b[fileHeaderLen+4:fileHeaderLen+infoLen]); err != nil {
 		if err == io.EOF {
 			err = io.ErrUnexpectedEOF
 		}
-		return Size{}, err
-	}
-	width := int(int32(readUint32(b[18:22])))
-	height := int(int32(readUint32(b[22:26])))
-	if height < 0 {
-		height = -height
+		return Info{}, err
 	}
+	h := parseDIBHeader(b[fileHeaderLen : fileHeaderLen+infoLen])
+	width, height := h.width, h.height
 	if width < 0 || height < 0 {
-		return Size{}, ErrUnsupported
+		return Info{}, ErrUnsupported
 	}
 	// We only support 1 plane and 8, 24 or 32 bits per pixel and no
 	// compression.
-	planes, bpp, compression := readUint16(b[26:28]), readUint16(b[28:30]), readUint32(b[30:34])
-	// if compression is set to BI_BITFIELDS, but the bitmask is set to the default bitmask
-	// that would be used if compression was set to 0, we can continue as if compression was 0
-	if compression == 3 && infoLen > infoHeaderLen &&
-		readUint32(b[54:58]) == 0xff0000 && readUint32(b[58:62]) == 0xff00 &&
-		readUint32(b[62:66]) == 0xff && readUint32(b[66:70]) == 0xff000000 {
-		compression = 0
+	if h.planes != 1 || h.compression != 0 {
+		return Info{}, ErrUnsupported
 	}
-	if planes != 1 || compression != 0 {
-		return Size{}, ErrUnsupported
+	info = Info{
+		Size:       Size{Width: width, Height: height},
+		BitDepth:   8,
+		ColorModel: ColorRGB,
+		Frames:     1,
 	}
-	switch bpp {
+	switch h.bpp {
 	case 8:
-		colorUsed := readUint32(b[46:50])
+		colorUsed := h.colorUsed
 		// If colorUsed is 0, it is set to the maximum number of colors for the given bpp, which is 2^bpp.
 		if colorUsed == 0 {
 			colorUsed = 256
 		} else if colorUsed > 256 {
-			return Size{}, ErrUnsupported
+			return Info{}, ErrUnsupported
 		}
 
 		if offset != fileHeaderLen+infoLen+colorUsed*4 {
-			return Size{}, ErrUnsupported
+			return Info{}, ErrUnsupported
 		}
 		_, err = io.ReadFull(r, b[:colorUsed*4])
 		if err != nil {
-			return Size{}, err
+			return Info{}, err
 		}
 		pcm := make(color.Palette, colorUsed)
 		for i := range pcm {
@@ -101,15 +129,16 @@ func decodebmp(r io.Reader) (size Size, err error) {
 			// Every 4th byte is padding.
 			pcm[i] = color.RGBA{b[4*i+2], b[4*i+1], b[4*i+0], 0xFF}
 		}
-		return Size{Width: width, Height: height}, nil
+		info.ColorModel = ColorPalette
+		return info, nil
 	case 24:
 		if offset != fileHeaderLen+infoLen {
-			return Size{}, ErrUnsupported
+			return Info{}, ErrUnsupported
 		}
-		return Size{Width: width, Height: height}, nil
+		return info, nil
 	case 32:
 		if offset != fileHeaderLen+infoLen {
-			return Size{}, ErrUnsupported
+			return Info{}, ErrUnsupported
 		}
 		// 32 bits per pixel is possibly RGBX (X is padding) or RGBA (A is
 		// alpha transparency). However, for BMP images, "Alpha is a
@@ -131,7 +160,8 @@ func decodebmp(r io.Reader) (size Size, err error) {
 		// This Go package does not support ICO files and the (infoLen >
 		// infoHeaderLen) condition distinguishes BITMAPINFOHEADER (40 bytes)
 		// vs later (larger) headers.
-		return Size{Width: width, Height: height}, nil
+		info.HasAlpha = infoLen > infoHeaderLen
+		return info, nil
 	}
-	return Size{}, ErrUnsupported
+	return Info{}, ErrUnsupported
 }
@@ -0,0 +1,153 @@
+// DDS files hold DirectDraw surfaces, described at
+// https://learn.microsoft.com/en-us/windows/win32/direct3ddds/dx-graphics-dds-pguide.
+// The magic is followed by a 124-byte header and, when its pixel format has
+// the DX10 FourCC, by a 20-byte extended header.
+
+package imgsz
+
+import (
+	"io"
+	"strconv"
+)
+
+const (
+	ddsHeader = "DDS "
+
+	ddsHeaderLen = 128 // Magic included.
+	dx10Len      = 20
+)
+
+// Header flags.
+const (
+	ddsdMipMapCount = 0x20000
+	ddsdDepth       = 0x800000
+)
+
+// Pixel format flags.
+const (
+	ddpfAlphaPixels = 0x1
+	ddpfAlpha       = 0x2
+	ddpfFourCC      = 0x4
+	ddpfRGB         = 0x40
+	ddpfLuminance   = 0x20000
+)
+
+// Caps2 flags. Each face of a cubemap has its own flag.
+const (
+	ddsCaps2Cubemap   = 0x200
+	ddsCaps2CubeFaces = 0xfc00
+	ddsCaps2Volume    = 0x200000
+)
+
+// DX10 header fields.
+const (
+	dx10Texture3D      = 4   // Resource dimension.
+	dx10MiscCube       = 0x4 // Misc flag.
+	dx10MaxArrayLayers = 2048
+)
+
+// maskDepth returns the number of bits set in a channel mask.
+func maskDepth(m uint32) int {
+	n := 0
+	for ; m != 0; m &= m - 1 {
+		n++
+	}
+	return n
+}
+
+// ddsFourCC formats the FourCC field of a DDS pixel format.
+func ddsFourCC(b []byte) string {
+	for _, c := range b {
+		if c < ' ' || c > '~' {
+			return strconv.FormatUint(uint64(readUint32(b)), 10)
+		}
+	}
+	return string(b)
+}
+
+// decodeDDS reads the headers of a DDS file.
+func decodeDDS(r io.Reader) (Texture, Info, error) {
+	var b [ddsHeaderLen + dx10Len]byte
+	if err := readFull(r, b[:ddsHeaderLen]); err != nil {
+		return Texture{}, Info{}, err
+	}
+	if string(b[:4]) != ddsHeader || readUint32(b[4:8]) != 124 || readUint32(b[76:80]) != 32 {
+		return Texture{}, Info{}, FormatError("bad DDS header")
+	}
+	flags := readUint32(b[8:12])
+	tex := Texture{
+		Size: Size{
+			Width:  int(readUint32(b[16:20])),
+			Height: int(readUint32(b[12:16])),
+		},
+		Depth:     1,
+		MipLevels: 1,
+		Layers:    1,
+		Faces:     1,
+	}
+	if tex.Width <= 0 || tex.Height <= 0 {
+		return Texture{}, Info{}, FormatError("bad DDS dimensions")
+	}
+	caps2 := readUint32(b[112:116])
+	if flags&ddsdDepth != 0 || caps2&ddsCaps2Volume != 0 {
+		if d := int(readUint32(b[24:28])); d > 1 {
+			tex.Depth = d
+		}
+	}
+	if flags&ddsdMipMapCount != 0 {
+		if n := int(readUint32(b[28:32])); n > 1 {
+			tex.MipLevels = n
+		}
+	}
+	if caps2&ddsCaps2Cubemap != 0 {
+		tex.Faces = maskDepth(caps2 & ddsCaps2CubeFaces)
+		if tex.Faces == 0 {
+			tex.Faces = 6
+		}
+	}
+
+	info := Info{Size: tex.Size, Frames: 1}
+	pfFlags := readUint32(b[80:84])
+	switch {
+	case pfFlags&ddpfFourCC != 0:
+		tex.FourCC = ddsFourCC(b[84:88])
+	case pfFlags&ddpfRGB != 0:
+		info.ColorModel, info.Channels = ColorRGB, 3
+		info.BitDepth = maskDepth(readUint32(b[92:96]))
+		info.SampleFormat = SampleUint
+	case pfFlags&ddpfLuminance != 0:
+		info.ColorModel, info.Channels = ColorGray, 1
+		info.BitDepth = maskDepth(readUint32(b[92:96]))
+		info.SampleFormat = SampleUint
+	case pfFlags&ddpfAlpha != 0:
+		info.Channels, info.HasAlpha = 1, true
+		info.BitDepth = maskDepth(readUint32(b[104:108]))
+		info.SampleFormat = SampleUint
+	}
+	if pfFlags&ddpfAlphaPixels != 0 && info.Channels > 0 {
+		info.Channels++
+		info.HasAlpha = true
+	}
+
+	if tex.FourCC == "DX10" {
+		if err := readFull(r, b[ddsHeaderLen:]); err != nil {
+			return Texture{}, Info{}, err
+		}
+		x := b[ddsHeaderLen:]
+		tex.DXGIFormat = int(readUint32(x[0:4]))
+		if readUint32(x[4:8]) != dx10Texture3D {
+			tex.Depth = 1
+		}
+		if readUint32(x[8:12])&dx10MiscCube != 0 {
+			tex.Faces = 6
+		}
+		n := readUint32(x[12:16])
+		if n > dx10MaxArrayLayers {
+			return Texture{}, Info{}, FormatError("bad DDS array size")
+		}
+		if n > 1 {
+			tex.Layers = int(n)
+		}
+	}
+	return tex, info, nil
+}
@@ -0,0 +1,267 @@
+// DICOM files, described in part 10 of the DICOM standard, start with a
+// 128-byte preamble and the "DICM" prefix, followed by the file meta
+// information in explicit VR little endian. Its transfer syntax tells how
+// the data set that follows is encoded: with explicit or implicit value
+// representations, in little or big endian, and maybe deflated. The data
+// elements are sorted by tag, so the image pixel module is found before
+// the pixel data.
+
+package imgsz
+
+import (
+	"bufio"
+	"compress/flate"
+	"encoding/binary"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	dicomPreambleLen = 128
+	dicomPrefix      = "DICM"
+)
+
+// Transfer syntaxes that change how the data set is read.
+const (
+	tsImplicitLE = "1.2.840.10008.1.2"
+	tsExplicitBE = "1.2.840.10008.1.2.2"
+	tsDeflated   = "1.2.840.10008.1.2.1.99"
+)
+
+// Data element tags, as group<<16 | element.
+const (
+	dTransferSyntax       = 0x00020010
+	dSamplesPerPixel      = 0x00280002
+	dPhotometric          = 0x00280004
+	dNumberOfFrames       = 0x00280008
+	dRows                 = 0x00280010
+	dColumns              = 0x00280011
+	dBitsAllocated        = 0x00280100
+	dBitsStored           = 0x00280101
+	dPixelRepresentation  = 0x00280103
+	dItem                 = 0xfffee000
+	dItemDelimitation     = 0xfffee00d
+	dSequenceDelimitation = 0xfffee0dd
+)
+
+const (
+	dicomUndefinedLength    = 0xffffffff
+	dicomMaxValue           = 1 << 10 // The longest value of interest.
+	dicomMaxSequenceNesting = 64
+)
+
+// dicomdecoder walks the data elements of a DICOM file.
+type dicomdecoder struct {
+	r        *bufio.Reader
+	order    binary.ByteOrder
+	explicit bool
+	buf      [12]byte
+}
+
+// dicomLongVR reports whether an explicit VR has a 32-bit length, preceded
+// by two reserved bytes.
+func dicomLongVR(vr string) bool {
+	switch vr {
+	case "OB", "OD", "OF", "OL", "OV", "OW", "SQ", "SV", "UC", "UN", "UR", "UT", "UV":
+		return true
+	}
+	return false
+}
+
+// element reads the header of the next data element, and returns its tag,
+// its VR, which is empty for implicit VR, and the length of its value.
+func (d *dicomdecoder) element() (tag uint32, vr string, n uint32, err error) {
+	b := d.buf[:]
+	if err = readFull(d.r, b[:8]); err != nil {
+		return
+	}
+	tag = uint32(d.order.Uint16(b[0:2]))<<16 | uint32(d.order.Uint16(b[2:4]))
+	// Items and delimiters have no VR, whatever the transfer syntax.
+	if !d.explicit || tag>>16 == 0xfffe {
+		return tag, "", d.order.Uint32(b[4:8]), nil
+	}
+	vr = string(b[4:6])
+	if !dicomLongVR(vr) {
+		return tag, vr, uint32(d.order.Uint16(b[6:8])), nil
+	}
+	if err = readFull(d.r, b[8:12]); err != nil {
+		return
+	}
+	return tag, vr, d.order.Uint32(b[8:12]), nil
+}
+
+// value reads a value of length n, or skips it if it is not wanted.
+func (d *dicomdecoder) value(n uint32, want bool) ([]byte, error) {
+	if !want || n > dicomMaxValue {
+		if _, err := io.CopyN(io.Discard, d.r, int64(n)); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		return nil, nil
+	}
+	b := make([]byte, n)
+	return b, readFull(d.r, b)
+}
+
+// uint returns the first value of a US element.
+func (d *dicomdecoder) uint(b []byte) int {
+	if len(b) < 2 {
+		return 0
+	}
+	return int(d.order.Uint16(b))
+}
+
+// meta reads the file meta information, and sets up d to read the data set
+// in the transfer syntax that it gives.
+func (d *dicomdecoder) meta() error {
+	d.order, d.explicit = binary.LittleEndian, true
+	ts := ""
+	for {
+		b, err := d.r.Peek(2)
+		if err != nil {
+			if err == io.EOF {
+				err = FormatError("missing DICOM data set")
+			}
+			return err
+		}
+		if binary.LittleEndian.Uint16(b) != 0x0002 {
+			break
+		}
+		tag, _, n, err := d.element()
+		if err != nil {
+			return err
+		}
+		if n == dicomUndefinedLength {
+			return FormatError("bad DICOM file meta information")
+		}
+		v, err := d.value(n, tag == dTransferSyntax)
+		if err != nil {
+			return err
+		}
+		if tag == dTransferSyntax {
+			ts = strings.TrimRight(string(v), "\x00 ")
+		}
+	}
+	switch ts {
+	case tsImplicitLE:
+		d.explicit = false
+	case tsExplicitBE:
+		d.order = binary.BigEndian
+	case tsDeflated:
+		d.r = bufio.NewReader(flate.NewReader(d.r))
+	}
+	return nil
+}
+
+// decodedicom returns the dimensions, frames and pixel format of a DICOM
+// image.
+func decodedicom(r io.Reader) (Info, error) {
+	d := &dicomdecoder{r: bufio.NewReader(r)}
+	if _, err := d.value(dicomPreambleLen, false); err != nil {
+		return Info{}, err
+	}
+	var prefix [4]byte
+	if err := readFull(d.r, prefix[:]); err != nil {
+		return Info{}, err
+	}
+	if string(prefix[:]) != dicomPrefix {
+		return Info{}, FormatError("missing DICM prefix")
+	}
+	if err := d.meta(); err != nil {
+		return Info{}, err
+	}
+
+	info := Info{Channels: 1, SampleFormat: SampleUint, Frames: 1}
+	var allocated int
+	for depth := 0; ; {
+		tag, vr, n, err := d.element()
+		if err == io.ErrUnexpectedEOF && depth == 0 {
+			// The data set may end without pixel data.
+			break
+		}
+		if err != nil {
+			return Info{}, err
+		}
+		if depth == 0 && tag > dPixelRepresentation {
+			break
+		}
+		switch {
+		case tag == dItem && n != dicomUndefinedLength:
+			if _, err := d.value(n, false); err != nil {
+				return Info{}, err
+			}
+			continue
+		case tag == dItem || tag == dItemDelimitation:
+			continue
+		case tag == dSequenceDelimitation:
+			if depth == 0 {
+				return Info{}, FormatError("bad DICOM sequence delimiter")
+			}
+			depth--
+			continue
+		case n == dicomUndefinedLength:
+			// Only a sequence may have an undefined length before the
+			// pixel data. Its items are walked as they come.
+			if vr != "" && vr != "SQ" && vr != "UN" {
+				return Info{}, FormatError("bad DICOM value length")
+			}
+			if depth++; depth > dicomMaxSequenceNesting {
+				return Info{}, UnsupportedError("DICOM sequences nested too deep")
+			}
+			continue
+		}
+		want := depth == 0 && tag>>16 == 0x0028
+		v, err := d.value(n, want)
+		if err != nil {
+			return Info{}, err
+		}
+		if !want {
+			continue
+		}
+		switch tag {
+		case dSamplesPerPixel:
+			info.Channels = d.uint(v)
+		case dPhotometric:
+			switch p := strings.TrimRight(string(v), "\x00 "); {
+			case p == "MONOCHROME1" || p == "MONOCHROME2":
+				info.ColorModel = ColorGray
+			case p == "RGB" || p == "ARGB":
+				info.ColorModel = ColorRGB
+			case strings.HasPrefix(p, "YBR_"):
+				info.ColorModel = ColorYCbCr
+			case p == "PALETTE COLOR":
+				info.ColorModel = ColorPalette
+			case p == "CMYK":
+				info.ColorModel = ColorCMYK
+			}
+		case dNumberOfFrames:
+			f, err := strconv.Atoi(strings.Trim(string(v), "\x00 "))
+			if err != nil || f < 1 {
+				return Info{}, FormatError("bad DICOM Number of Frames")
+			}
+			info.Frames = f
+		case dRows:
+			info.Height = d.uint(v)
+		case dColumns:
+			info.Width = d.uint(v)
+		case dBitsAllocated:
+			allocated = d.uint(v)
+		case dBitsStored:
+			info.BitDepth = d.uint(v)
+		case dPixelRepresentation:
+			if d.uint(v) == 1 {
+				info.SampleFormat = SampleInt
+			}
+		}
+	}
+	if info.Width == 0 || info.Height == 0 {
+		return Info{}, FormatError("missing DICOM Rows or Columns")
+	}
+	if info.BitDepth == 0 {
+		info.BitDepth = allocated
+	}
+	return info, nil
+}
@@ -0,0 +1,410 @@
+// EXIF data is TIFF structured: a TIFF header followed by IFDs, as specified
+// in section 4.6 of the Exif 2.32 specification. JPEG carries it in an APP1
+// segment, PNG in an eXIf chunk and WebP in an EXIF chunk.
+
+package imgsz
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// exifHeader precedes the TIFF structured EXIF data in a JPEG APP1 segment.
+const exifHeader = "Exif\x00\x00"
+
+// ErrNoExif indicates that an image carries no EXIF data.
+var ErrNoExif = errors.New("image: no EXIF data")
+
+// A Rational is an unsigned fraction.
+type Rational struct {
+	Num, Den uint32
+}
+
+// An SRational is a signed fraction.
+type SRational struct {
+	Num, Den int32
+}
+
+// An ExifValue is the decoded value of an IFD entry. Type is its TIFF data
+// type, and Value holds
+//
+//   - a string for ASCII,
+//   - a []byte for BYTE and UNDEFINED,
+//   - a []int8 for SBYTE,
+//   - a []uint16 for SHORT and a []int16 for SSHORT,
+//   - a []uint32 for LONG and IFD and a []int32 for SLONG,
+//   - a []uint64 for LONG8 and IFD8 and a []int64 for SLONG8,
+//   - a []Rational for RATIONAL and a []SRational for SRATIONAL,
+//   - a []float32 for FLOAT and a []float64 for DOUBLE.
+type ExifValue struct {
+	Type  uint16
+	Value interface{}
+}
+
+// Int returns the i'th value as an integer. It reports false if the value
+// is not of an integer type or i is out of range.
+func (v ExifValue) Int(i int) (int64, bool) {
+	if i < 0 {
+		return 0, false
+	}
+	switch x := v.Value.(type) {
+	case []byte:
+		if i < len(x) && v.Type == dtByte {
+			return int64(x[i]), true
+		}
+	case []int8:
+		if i < len(x) {
+			return int64(x[i]), true
+		}
+	case []uint16:
+		if i < len(x) {
+			return int64(x[i]), true
+		}
+	case []int16:
+		if i < len(x) {
+			return int64(x[i]), true
+		}
+	case []uint32:
+		if i < len(x) {
+			return int64(x[i]), true
+		}
+	case []int32:
+		if i < len(x) {
+			return int64(x[i]), true
+		}
+	case []uint64:
+		if i < len(x) {
+			return int64(x[i]), true
+		}
+	case []int64:
+		if i < len(x) {
+			return x[i], true
+		}
+	}
+	return 0, false
+}
+
+// Float returns the i'th value as a floating-point number. It reports false
+// if the value is not numeric, i is out of range or a fraction has a zero
+// denominator.
+func (v ExifValue) Float(i int) (float64, bool) {
+	if n, ok := v.Int(i); ok {
+		return float64(n), true
+	}
+	if i < 0 {
+		return 0, false
+	}
+	switch x := v.Value.(type) {
+	case []Rational:
+		if i < len(x) && x[i].Den != 0 {
+			return float64(x[i].Num) / float64(x[i].Den), true
+		}
+	case []SRational:
+		if i < len(x) && x[i].Den != 0 {
+			return float64(x[i].Num) / float64(x[i].Den), true
+		}
+	case []float32:
+		if i < len(x) {
+			return float64(x[i]), true
+		}
+	case []float64:
+		if i < len(x) {
+			return x[i], true
+		}
+	}
+	return 0, false
+}
+
+// String returns an ASCII or UNDEFINED value as text, and the other types
+// formatted as a list.
+func (v ExifValue) String() string {
+	switch x := v.Value.(type) {
+	case string:
+		return x
+	case []byte:
+		if v.Type == dtUndefined {
+			return strings.TrimRight(string(x), "\x00")
+		}
+	}
+	return fmt.Sprint(v.Value)
+}
+
+// An ExifIFD maps the tags of an image file directory to their values.
+type ExifIFD map[uint16]ExifValue
+
+// Exif holds the IFDs of EXIF data. IFD0 describes the main image and IFD1
+// its thumbnail. The Exif and GPS IFDs are those that IFD0 points to. An IFD
+// that is absent or cannot be read is nil.
+type Exif struct {
+	IFD0, Exif, GPS, IFD1 ExifIFD
+}
+
+// Orientation returns the Orientation tag, from 1 to 8, or 0 if it is absent
+// or out of range.
+func (x *Exif) Orientation() int {
+	o, ok := x.IFD0[tOrientation].Int(0)
+	if !ok || o < 1 || o > 8 {
+		return 0
+	}
+	return int(o)
+}
+
+// Make returns the manufacturer of the camera, or "" if it is not recorded.
+func (x *Exif) Make() string {
+	return strings.TrimSpace(x.ascii(x.IFD0, tMake))
+}
+
+// Model returns the model of the camera, or "" if it is not recorded.
+func (x *Exif) Model() string {
+	return strings.TrimSpace(x.ascii(x.IFD0, tModel))
+}
+
+func (x *Exif) ascii(ifd ExifIFD, tag uint16) string {
+	s, _ := ifd[tag].Value.(string)
+	return s
+}
+
+// DateTime returns when the picture was taken, falling back to when the
+// file was last changed. Without a recorded time zone offset, the time is
+// returned in UTC. It reports false if no time is recorded.
+func (x *Exif) DateTime() (time.Time, bool) {
+	s, offset := x.ascii(x.Exif, tDateTimeOriginal), x.ascii(x.Exif, tOffsetTimeOriginal)
+	if s == "" {
+		s, offset = x.ascii(x.IFD0, tDateTime), ""
+	}
+	loc := time.UTC
+	if o, err := time.Parse("-07:00", strings.TrimSpace(offset)); err == nil {
+		_, sec := o.Zone()
+		loc = time.FixedZone(offset, sec)
+	}
+	t, err := time.ParseInLocation("2006:01:02 15:04:05", strings.TrimSpace(s), loc)
+	return t, err == nil
+}
+
+// LatLong returns the GPS position in degrees, north and east being
+// positive. It reports false if no position is recorded.
+func (x *Exif) LatLong() (lat, long float64, ok bool) {
+	lat, ok1 := x.degrees(gpsLatitude, gpsLatitudeRef, "S")
+	long, ok2 := x.degrees(gpsLongitude, gpsLongitudeRef, "W")
+	return lat, long, ok1 && ok2
+}
+
+// degrees converts a GPS coordinate, stored as degrees, minutes and
+// seconds, to degrees.
+func (x *Exif) degrees(tag, ref uint16, negative string) (float64, bool) {
+	v := x.GPS[tag]
+	var deg float64
+	for i, unit := range [3]float64{1, 60, 3600} {
+		f, ok := v.Float(i)
+		if !ok {
+			return 0, false
+		}
+		deg += f / unit
+	}
+	if strings.EqualFold(strings.TrimSpace(x.ascii(x.GPS, ref)), negative) {
+		deg = -deg
+	}
+	return deg, true
+}
+
+// ifdValue decodes the IFD entry in p, of any data type.
+func (d *tiffdecoder) ifdValue(p []byte) (ExifValue, error) {
+	datatype, count, raw, err := d.ifdData(p)
+	if err != nil {
+		return ExifValue{}, err
+	}
+	bo := d.byteOrder
+	v := ExifValue{Type: datatype}
+	switch datatype {
+	case dtByte, dtUndefined:
+		v.Value = append([]byte(nil), raw...)
+	case dtASCII:
+		v.Value = strings.TrimRight(string(raw), "\x00")
+	case dtSByte:
+		u := make([]int8, count)
+		for i := range u {
+			u[i] = int8(raw[i])
+		}
+		v.Value = u
+	case dtShort:
+		u := make([]uint16, count)
+		for i := range u {
+			u[i] = bo.Uint16(raw[2*i:])
+		}
+		v.Value = u
+	case dtSShort:
+		u := make([]int16, count)
+		for i := range u {
+			u[i] = int16(bo.Uint16(raw[2*i:]))
+		}
+		v.Value = u
+	case dtLong, dtIFD:
+		u := make([]uint32, count)
+		for i := range u {
+			u[i] = bo.Uint32(raw[4*i:])
+		}
+		v.Value = u
+	case dtSLong:
+		u := make([]int32, count)
+		for i := range u {
+			u[i] = int32(bo.Uint32(raw[4*i:]))
+		}
+		v.Value = u
+	case dtRational:
+		u := make([]Rational, count)
+		for i := range u {
+			u[i] = Rational{bo.Uint32(raw[8*i:]), bo.Uint32(raw[8*i+4:])}
+		}
+		v.Value = u
+	case dtLong8, dtIFD8:
+		u := make([]uint64, count)
+		for i := range u {
+			u[i] = bo.Uint64(raw[8*i:])
+		}
+		v.Value = u
+	case dtSLong8:
+		u := make([]int64, count)
+		for i := range u {
+			u[i] = int64(bo.Uint64(raw[8*i:]))
+		}
+		v.Value = u
+	case dtSRational:
+		u := make([]SRational, count)
+		for i := range u {
+			u[i] = SRational{int32(bo.Uint32(raw[8*i:])), int32(bo.Uint32(raw[8*i+4:]))}
+		}
+		v.Value = u
+	case dtFloat:
+		u := make([]float32, count)
+		for i := range u {
+			u[i] = math.Float32frombits(bo.Uint32(raw[4*i:]))
+		}
+		v.Value = u
+	case dtDouble:
+		u := make([]float64, count)
+		for i := range u {
+			u[i] = math.Float64frombits(bo.Uint64(raw[8*i:]))
+		}
+		v.Value = u
+	}
+	return v, nil
+}
+
+// exifIFD reads the IFD at offset off, and returns its entries and the
+// offset of the next IFD. Entries whose data cannot be read are left out.
+func (d *tiffdecoder) exifIFD(off int64) (ExifIFD, int64, error) {
+	p, next, err := d.ifdEntries(off)
+	if err != nil {
+		return nil, 0, err
+	}
+	n := d.entryLen()
+	ifd := make(ExifIFD, len(p)/n)
+	for i := 0; i < len(p); i += n {
+		if v, err := d.ifdValue(p[i : i+n]); err == nil {
+			ifd[d.byteOrder.Uint16(p[i:i+2])] = v
+		}
+	}
+	return ifd, next, nil
+}
+
+// parseExif reads the IFDs of the TIFF structured data in r.
+func parseExif(r io.ReaderAt) (*Exif, error) {
+	d := &tiffdecoder{r: r}
+	off, err := d.readHeader()
+	if err != nil {
+		return nil, err
+	}
+	x := new(Exif)
+	seen := map[int64]bool{off: true}
+	x.IFD0, off, err = d.exifIFD(off)
+	if err != nil {
+		return nil, err
+	}
+	// The other IFDs are optional, so a damaged one is skipped rather than
+	// failing the whole.
+	sub := func(off int64) ExifIFD {
+		if off <= 0 || seen[off] {
+			return nil
+		}
+		seen[off] = true
+		ifd, _, _ := d.exifIFD(off)
+		return ifd
+	}
+	if o, ok := x.IFD0[tExifIFD].Int(0); ok {
+		x.Exif = sub(o)
+	}
+	if o, ok := x.IFD0[tGPSIFD].Int(0); ok {
+		x.GPS = sub(o)
+	}
+	x.IFD1 = sub(off)
+	return x, nil
+}
+
+// ParseExif parses TIFF structured EXIF data, such as the payload of a JPEG
+// APP1 segment. A leading "Exif\x00\x00" header is skipped.
+func ParseExif(b []byte) (*Exif, error) {
+	return parseExif(bytes.NewReader(bytes.TrimPrefix(b, []byte(exifHeader))))
+}
+
+// DecodeExif reads the EXIF data of an image that has been encoded in a
+// registered format. The string returned is the format name. EXIF data is
+// found in JPEG, PNG, WebP and TIFF images.
+func DecodeExif(r io.Reader) (*Exif, string, error) {
+	return defaultDecoder.DecodeExif(r)
+}
+
+// DecodeExif is like the DecodeExif function, for the formats of d.
+func (d *Decoder) DecodeExif(r io.Reader) (*Exif, string, error) {
+	rr, f, err := d.detect(r)
+	if err != nil {
+		return nil, f.name, err
+	}
+	var b []byte
+	switch f.name {
+	case "jpeg":
+		var jd jpgdecoder
+		_, err = jd.decode(rr)
+		b = jd.exif
+	case "png":
+		b, err = pngExif(rr)
+	case "webp":
+		b, err = webpExif(rr)
+	case "tiff":
+		x, err := parseExif(newReaderAt(rr))
+		return x, f.name, err
+	default:
+		return nil, f.name, UnsupportedError("EXIF data in " + f.name)
+	}
+	if err == nil && b == nil {
+		err = ErrNoExif
+	}
+	if err != nil {
+		return nil, f.name, err
+	}
+	x, err := ParseExif(b)
+	return x, f.name, err
+}
+
+// orient returns the size of an image of size s once the EXIF orientation o
+// is applied. Orientations 5 to 8 transpose the image.
+func (s Size) orient(o int) Size {
+	if o >= 5 && o <= 8 {
+		return Size{s.Height, s.Width}
+	}
+	return s
+}
+
+// exifOrientation returns the Orientation tag of the TIFF structured EXIF
+// data in b, or 0 if it has none or b cannot be parsed.
+func exifOrientation(b []byte) int {
+	x, err := ParseExif(b)
+	if err != nil {
+		return 0
+	}
+	return x.Orientation()
+}
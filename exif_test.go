@@ -0,0 +1,139 @@
+package imgsz
+
+import (
+	"bytes"
+	"hash/crc32"
+	"testing"
+	"time"
+)
+
+func be16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+func be32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+// pngChunk returns a PNG chunk of type typ with its length and checksum.
+func pngChunk(typ string, data []byte) []byte {
+	b := be32(nil, uint32(len(data)))
+	b = append(b, typ...)
+	b = append(b, data...)
+	return be32(b, crc32.ChecksumIEEE(b[4:]))
+}
+
+type testEntry struct {
+	tag, typ uint16
+	count    uint32
+	data     []byte
+}
+
+func ascii(tag uint16, s string) testEntry {
+	return testEntry{tag, dtASCII, uint32(len(s) + 1), append([]byte(s), 0)}
+}
+
+func long(tag uint16, v uint32) testEntry {
+	return testEntry{tag, dtLong, 1, be32(nil, v)}
+}
+
+func rationals(tag uint16, v ...uint32) testEntry {
+	var b []byte
+	for _, x := range v {
+		b = be32(b, x)
+	}
+	return testEntry{tag, dtRational, uint32(len(v) / 2), b}
+}
+
+// testIFD lays out a big-endian IFD at offset base, with the data that does
+// not fit in the entries following it.
+func testIFD(base, next uint32, entries ...testEntry) []byte {
+	b := be16(nil, uint16(len(entries)))
+	var data []byte
+	dataOff := base + 2 + 12*uint32(len(entries)) + 4
+	for _, e := range entries {
+		b = be16(b, e.tag)
+		b = be16(b, e.typ)
+		b = be32(b, e.count)
+		if len(e.data) <= 4 {
+			b = append(b, e.data...)
+			b = append(b, make([]byte, 4-len(e.data))...)
+			continue
+		}
+		b = be32(b, dataOff+uint32(len(data)))
+		data = append(data, e.data...)
+	}
+	b = be32(b, next)
+	return append(b, data...)
+}
+
+func testExif() []byte {
+	exifIFD := []testEntry{
+		ascii(tDateTimeOriginal, "2024:05:06 07:08:09"),
+		ascii(tOffsetTimeOriginal, "+09:00"),
+		{37380, dtSRational, 1, []byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 3}},
+	}
+	gpsIFD := []testEntry{
+		ascii(gpsLatitudeRef, "N"),
+		rationals(gpsLatitude, 35, 1, 30, 1, 0, 1),
+		ascii(gpsLongitudeRef, "W"),
+		rationals(gpsLongitude, 139, 1, 45, 1, 36, 1),
+	}
+	ifd0 := func(exif, gps, next uint32) []byte {
+		return testIFD(8, next,
+			ascii(tMake, "Canon"),
+			ascii(tModel, "EOS R5"),
+			testEntry{tOrientation, dtShort, 1, []byte{0, 6}},
+			long(tExifIFD, exif),
+			long(tGPSIFD, gps),
+		)
+	}
+	n0 := uint32(len(ifd0(0, 0, 0)))
+	e := testIFD(8+n0, 0, exifIFD...)
+	g := testIFD(8+n0+uint32(len(e)), 0, gpsIFD...)
+	ifd1Off := 8 + n0 + uint32(len(e)) + uint32(len(g))
+	b := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	b = append(b, ifd0(8+n0, 8+n0+uint32(len(e)), ifd1Off)...)
+	b = append(b, e...)
+	b = append(b, g...)
+	return append(b, testIFD(ifd1Off, 0, long(tImageWidth, 160))...)
+}
+
+func TestExif(t *testing.T) {
+	x, err := ParseExif(append([]byte(exifHeader), testExif()...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x.Make() != "Canon" || x.Model() != "EOS R5" || x.Orientation() != 6 {
+		t.Fatal(x.Make(), x.Model(), x.Orientation())
+	}
+	dt, ok := x.DateTime()
+	want := time.Date(2024, 5, 5, 22, 8, 9, 0, time.UTC)
+	if !ok || !dt.Equal(want) {
+		t.Fatal(dt, ok)
+	}
+	lat, long, ok := x.LatLong()
+	if !ok || lat != 35.5 || long != -(139+45.0/60+36.0/3600) {
+		t.Fatal(lat, long, ok)
+	}
+	if f, ok := x.Exif[37380].Float(0); !ok || f != -1.0/3 {
+		t.Fatal(f, ok)
+	}
+	if w, ok := x.IFD1[tImageWidth].Int(0); !ok || w != 160 {
+		t.Fatal(w, ok)
+	}
+
+	// The same data in a PNG eXIf chunk, after the image data.
+	png := []byte(pngHeader)
+	png = append(png, pngChunk("IHDR", []byte{0, 0, 0, 1, 0, 0, 0, 1, 8, 0, 0, 0, 0})...)
+	png = append(png, pngChunk("IDAT", []byte{0x78, 0x9c})...)
+	png = append(png, pngChunk("eXIf", testExif())...)
+	png = append(png, pngChunk("IEND", nil)...)
+	x, name, err := DecodeExif(bytes.NewReader(png))
+	if err != nil || name != "png" {
+		t.Fatal(name, err)
+	}
+	if x.Model() != "EOS R5" {
+		t.Fatal(x.Model())
+	}
+}
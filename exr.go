@@ -0,0 +1,318 @@
+// OpenEXR files, described at https://openexr.com/en/latest/OpenEXRFileLayout.html,
+// start with a magic number and a version field, followed by a header made of
+// typed attributes. A multi-part file has one header per part.
+
+package imgsz
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"image"
+	"io"
+)
+
+const exrHeader = "v/1\x01"
+
+// Version field flags.
+const (
+	exrTiled     = 0x200
+	exrLongNames = 0x400
+	exrMultipart = 0x1000
+)
+
+// Channel pixel types.
+const (
+	exrUint  = 0
+	exrHalf  = 1
+	exrFloat = 2
+)
+
+const (
+	exrMaxAttr  = 1 << 20 // The largest attribute value we buffer.
+	exrMaxParts = 1 << 10
+)
+
+// An EXRPart describes one part of an OpenEXR file.
+type EXRPart struct {
+	// Name is the name attribute of a part of a multi-part file.
+	Name string
+	// DataWindow bounds the pixels stored, and DisplayWindow the image that
+	// a viewer shows.
+	DataWindow, DisplayWindow image.Rectangle
+	// Channels lists the channel names, such as "R" or "diffuse.A".
+	Channels []string
+	Tiled    bool
+}
+
+// EXRInfo describes the header of an OpenEXR file.
+type EXRInfo struct {
+	Multipart bool
+	// Parts lists the parts of a multi-part file, or holds the one part of
+	// another file.
+	Parts []EXRPart
+}
+
+// exrdecoder reads the header of an OpenEXR file.
+type exrdecoder struct {
+	r         *bufio.Reader
+	nameLen   int
+	channels  []exrChannel
+	multipart bool
+}
+
+type exrChannel struct {
+	name      string
+	pixelType uint32
+}
+
+// cstring reads a null-terminated string of at most d.nameLen bytes.
+func (d *exrdecoder) cstring() (string, error) {
+	var s []byte
+	for {
+		c, err := d.r.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return "", err
+		}
+		if c == 0 {
+			return string(s), nil
+		}
+		if len(s) == d.nameLen {
+			return "", FormatError("EXR name too long")
+		}
+		s = append(s, c)
+	}
+}
+
+// exrBox parses a box2i attribute, whose maximum coordinates are inclusive.
+func exrBox(b []byte) (image.Rectangle, error) {
+	if len(b) != 16 {
+		return image.Rectangle{}, FormatError("bad EXR box2i attribute")
+	}
+	var v [4]int
+	for i := range v {
+		v[i] = int(int32(binary.LittleEndian.Uint32(b[4*i:])))
+	}
+	if v[2] < v[0] || v[3] < v[1] {
+		return image.Rectangle{}, FormatError("bad EXR window")
+	}
+	return image.Rect(v[0], v[1], v[2]+1, v[3]+1), nil
+}
+
+// parseChlist parses a chlist attribute.
+func parseChlist(b []byte) ([]exrChannel, error) {
+	var chs []exrChannel
+	for {
+		i := bytes.IndexByte(b, 0)
+		if i < 0 {
+			return nil, FormatError("bad EXR chlist attribute")
+		}
+		if i == 0 {
+			return chs, nil
+		}
+		// The name is followed by the pixel type, pLinear, three reserved
+		// bytes and the x and y sampling.
+		if len(b) < i+1+16 {
+			return nil, FormatError("bad EXR chlist attribute")
+		}
+		chs = append(chs, exrChannel{
+			name:      string(b[:i]),
+			pixelType: binary.LittleEndian.Uint32(b[i+1:]),
+		})
+		b = b[i+1+16:]
+	}
+}
+
+// part reads the attributes of one header, up to the null byte that ends
+// it. It returns io.EOF at the null byte that ends the headers of a
+// multi-part file.
+func (d *exrdecoder) part(tiled bool) (EXRPart, error) {
+	p := EXRPart{Tiled: tiled}
+	d.channels = nil
+	var haveData, haveDisplay bool
+	for first := true; ; first = false {
+		name, err := d.cstring()
+		if err != nil {
+			return EXRPart{}, err
+		}
+		if name == "" {
+			if first && d.multipart {
+				return EXRPart{}, io.EOF
+			}
+			break
+		}
+		typ, err := d.cstring()
+		if err != nil {
+			return EXRPart{}, err
+		}
+		var nb [4]byte
+		if err := readFull(d.r, nb[:]); err != nil {
+			return EXRPart{}, err
+		}
+		n := int32(binary.LittleEndian.Uint32(nb[:]))
+		if n < 0 {
+			return EXRPart{}, FormatError("bad EXR attribute size")
+		}
+		switch name {
+		case "channels", "dataWindow", "displayWindow", "name", "type":
+		default:
+			if _, err := io.CopyN(io.Discard, d.r, int64(n)); err != nil {
+				if err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				return EXRPart{}, err
+			}
+			continue
+		}
+		if n > exrMaxAttr {
+			return EXRPart{}, UnsupportedError("EXR attribute too large")
+		}
+		b := make([]byte, n)
+		if err := readFull(d.r, b); err != nil {
+			return EXRPart{}, err
+		}
+		switch {
+		case name == "channels" && typ == "chlist":
+			if d.channels, err = parseChlist(b); err != nil {
+				return EXRPart{}, err
+			}
+			p.Channels = make([]string, len(d.channels))
+			for i, ch := range d.channels {
+				p.Channels[i] = ch.name
+			}
+		case name == "dataWindow" && typ == "box2i":
+			p.DataWindow, err = exrBox(b)
+			haveData = err == nil
+		case name == "displayWindow" && typ == "box2i":
+			p.DisplayWindow, err = exrBox(b)
+			haveDisplay = err == nil
+		case name == "name" && typ == "string":
+			p.Name = string(b)
+		case name == "type" && typ == "string":
+			// Only multi-part files have a type attribute.
+			p.Tiled = string(b) == "tiledimage" || string(b) == "deeptile"
+		}
+		if err != nil {
+			return EXRPart{}, err
+		}
+	}
+	if !haveData || !haveDisplay || len(p.Channels) == 0 {
+		return EXRPart{}, FormatError("missing required EXR attribute")
+	}
+	return p, nil
+}
+
+// info returns the Info of part p, whose channels d holds.
+func (d *exrdecoder) info(p EXRPart) Info {
+	info := Info{
+		Size:         Size{p.DataWindow.Dx(), p.DataWindow.Dy()},
+		Channels:     len(d.channels),
+		SampleFormat: SampleUint,
+		ColorSpace:   ColorSpaceLinear,
+		Frames:       1,
+	}
+	info.Stored = info.Size
+	info.Display = Size{p.DisplayWindow.Dx(), p.DisplayWindow.Dy()}
+	names := make(map[string]bool)
+	for _, ch := range d.channels {
+		names[ch.name] = true
+		bits := 32
+		if ch.pixelType == exrHalf {
+			bits = 16
+		}
+		if ch.pixelType != exrUint {
+			info.SampleFormat = SampleFloat
+		}
+		if bits > info.BitDepth {
+			info.BitDepth = bits
+		}
+	}
+	switch {
+	case names["R"] && names["G"] && names["B"]:
+		info.ColorModel = ColorRGB
+	case names["Y"] && names["RY"] && names["BY"]:
+		info.ColorModel = ColorYCbCr
+	case names["Y"]:
+		info.ColorModel = ColorGray
+	}
+	info.HasAlpha = names["A"]
+	return info
+}
+
+// decode reads the headers of an OpenEXR file, and returns the Info of its
+// first part.
+func (d *exrdecoder) decode(r io.Reader) (EXRInfo, Info, error) {
+	var b [8]byte
+	if err := readFull(r, b[:]); err != nil {
+		return EXRInfo{}, Info{}, err
+	}
+	if string(b[:4]) != exrHeader {
+		return EXRInfo{}, Info{}, FormatError("missing EXR magic number")
+	}
+	version := binary.LittleEndian.Uint32(b[4:8])
+	if version&0xff != 2 {
+		return EXRInfo{}, Info{}, UnsupportedError("EXR version")
+	}
+	d.r = bufio.NewReader(r)
+	d.nameLen = 31
+	if version&exrLongNames != 0 {
+		d.nameLen = 255
+	}
+	d.multipart = version&exrMultipart != 0
+	x := EXRInfo{Multipart: d.multipart}
+	var info Info
+	for {
+		p, err := d.part(version&exrTiled != 0)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return EXRInfo{}, Info{}, err
+		}
+		if len(x.Parts) == 0 {
+			info = d.info(p)
+		}
+		x.Parts = append(x.Parts, p)
+		if !d.multipart {
+			break
+		}
+		if len(x.Parts) == exrMaxParts {
+			return EXRInfo{}, Info{}, UnsupportedError("too many EXR parts")
+		}
+	}
+	if len(x.Parts) == 0 {
+		return EXRInfo{}, Info{}, FormatError("no EXR parts")
+	}
+	return x, info, nil
+}
+
+func decodeexr(r io.Reader) (Info, error) {
+	var d exrdecoder
+	_, info, err := d.decode(r)
+	return info, err
+}
+
+// DecodeEXR reads the header of every part of an OpenEXR file. It does not
+// detect the format of r, so no Decoder restricts it; Decoder.DecodeEXR does.
+func DecodeEXR(r io.Reader) (EXRInfo, error) {
+	var d exrdecoder
+	x, _, err := d.decode(r)
+	return x, err
+}
+
+// DecodeEXR is like the DecodeEXR function, but only reads the images that
+// d detects as OpenEXR and allows. The string returned is the format name.
+func (d *Decoder) DecodeEXR(r io.Reader) (EXRInfo, string, error) {
+	rr, f, err := d.detect(r)
+	if err != nil {
+		return EXRInfo{}, f.name, err
+	}
+	if f.name != "exr" {
+		return EXRInfo{}, f.name, UnsupportedError("EXR parts of " + f.name)
+	}
+	x, err := DecodeEXR(rr)
+	return x, f.name, err
+}
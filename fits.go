@@ -0,0 +1,116 @@
+// FITS files, described in the FITS Standard 4.0
+// (https://fits.gsfc.nasa.gov/fits_standard.html), start with a primary
+// header made of 80-character ASCII cards, ended by an END card. Its
+// mandatory keywords give the sample format and the length of each axis of
+// the primary data array.
+
+package imgsz
+
+import (
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	fitsHeader  = "SIMPLE  =                    T"
+	fitsCardLen = 80
+
+	fitsMaxCards = 1 << 14
+)
+
+// fitsCard splits a card into its keyword and its value, without the
+// comment that may follow it. A card that has no value indicator returns
+// an empty value.
+func fitsCard(c []byte) (key, value string) {
+	key = strings.TrimRight(string(c[:8]), " ")
+	if string(c[8:10]) != "= " {
+		return key, ""
+	}
+	value = string(c[10:])
+	if i := strings.IndexByte(value, '/'); i >= 0 && !strings.HasPrefix(strings.TrimSpace(value), "'") {
+		value = value[:i]
+	}
+	return key, strings.TrimSpace(value)
+}
+
+// decodefits returns the dimensions and sample format of the primary data
+// array of a FITS file. The third axis, if any, counts the frames.
+func decodefits(r io.Reader) (Info, error) {
+	var (
+		c      [fitsCardLen]byte
+		naxis  = -1
+		axes   [3]int
+		bitpix int
+		bzero  string
+	)
+	for i := 0; ; i++ {
+		if i == fitsMaxCards {
+			return Info{}, UnsupportedError("FITS header too long")
+		}
+		if err := readFull(r, c[:]); err != nil {
+			return Info{}, err
+		}
+		if i == 0 && string(c[:len(fitsHeader)]) != fitsHeader {
+			return Info{}, FormatError("missing FITS SIMPLE card")
+		}
+		key, value := fitsCard(c[:])
+		if key == "END" {
+			break
+		}
+		var err error
+		switch key {
+		case "BITPIX":
+			bitpix, err = strconv.Atoi(value)
+		case "NAXIS":
+			naxis, err = strconv.Atoi(value)
+		case "NAXIS1", "NAXIS2", "NAXIS3":
+			axes[key[5]-'1'], err = strconv.Atoi(value)
+		case "BZERO":
+			bzero = value
+		}
+		if err != nil {
+			return Info{}, FormatError("bad FITS " + key + " value " + strconv.Quote(value))
+		}
+	}
+	if naxis < 0 || naxis > 999 {
+		return Info{}, FormatError("bad FITS NAXIS")
+	}
+	if naxis == 0 {
+		return Info{}, UnsupportedError("FITS file without a primary data array")
+	}
+	info := Info{
+		Size:         Size{axes[0], 1},
+		Channels:     1,
+		SampleFormat: SampleInt,
+		ColorModel:   ColorGray,
+		Frames:       1,
+	}
+	if naxis >= 2 {
+		info.Height = axes[1]
+	}
+	if naxis >= 3 {
+		info.Frames = axes[2]
+	}
+	if info.Width <= 0 || info.Height <= 0 || info.Frames <= 0 {
+		return Info{}, FormatError("bad FITS axis length")
+	}
+	switch bitpix {
+	case 8:
+		info.BitDepth, info.SampleFormat = 8, SampleUint
+	case 16, 32, 64:
+		info.BitDepth = bitpix
+		// Unsigned integers are stored as signed ones offset by BZERO.
+		// FITS allows a D exponent, as in Fortran.
+		z, err := strconv.ParseFloat(strings.Replace(bzero, "D", "E", 1), 64)
+		if err == nil && z == math.Ldexp(1, bitpix-1) {
+			info.SampleFormat = SampleUint
+		}
+	case -32, -64:
+		info.BitDepth, info.SampleFormat = -bitpix, SampleFloat
+	default:
+		return Info{}, FormatError("bad FITS BITPIX")
+	}
+	return info, nil
+}
@@ -11,6 +11,31 @@ package imgsz
 import (
 	"fmt"
 	"io"
+	"time"
+)
+
+// Masks etc.
+const (
+	// Fields.
+	fColorTable         = 1 << 7
+	fInterlace          = 1 << 6
+	fColorTableBitsMask = 7
+
+	// Graphic control flags.
+	gcTransparentColorSet = 1 << 0
+)
+
+// Section indicators.
+const (
+	sExtension       = 0x21
+	sImageDescriptor = 0x2C
+	sTrailer         = 0x3B
+)
+
+// Extensions.
+const (
+	eGraphicControl = 0xF9
+	eApplication    = 0xFF
 )
 
 func readFull(r io.Reader, b []byte) error {
@@ -24,9 +49,20 @@ func readFull(r io.Reader, b []byte) error {
 // gifdecoder is the type used to decode a GIF file.
 type gifdecoder struct {
 	// From header.
-	vers   string
-	width  int
-	height int
+	vers         string
+	width        int
+	height       int
+	headerFields byte
+
+	// From the blocks up to the first image descriptor.
+	transparent bool
+	interlaced  bool
+
+	// From the Graphic Control Extension before the current frame, in
+	// hundredths of a second, and from the NETSCAPE2.0 extension.
+	delay     int
+	loopCount int
+	hasLoop   bool
 
 	// Used when decoding.
 	tmp [1024]byte // must be at least 768 so we can read color table
@@ -43,6 +79,192 @@ func (d *gifdecoder) readHeaderAndScreenDescriptor(r io.Reader) error {
 	}
 	d.width = int(d.tmp[6]) + int(d.tmp[7])<<8
 	d.height = int(d.tmp[8]) + int(d.tmp[9])<<8
+	d.headerFields = d.tmp[10]
 	// d.tmp[12] is the Pixel Aspect Ratio, which is ignored.
 	return nil
 }
+
+// readFirstImageDescriptor reads the global color table and the blocks that
+// follow it, up to and including the first image descriptor.
+func (d *gifdecoder) readFirstImageDescriptor(r io.Reader) error {
+	if d.headerFields&fColorTable != 0 {
+		n := 3 * (1 << (1 + uint(d.headerFields&fColorTableBitsMask)))
+		if err := readFull(r, d.tmp[:n]); err != nil {
+			return fmt.Errorf("gif: reading color table: %s", err)
+		}
+	}
+	for {
+		if err := readFull(r, d.tmp[:1]); err != nil {
+			return fmt.Errorf("gif: reading frames: %v", err)
+		}
+		switch d.tmp[0] {
+		case sExtension:
+			if err := d.readExtension(r); err != nil {
+				return err
+			}
+		case sImageDescriptor:
+			if err := readFull(r, d.tmp[:9]); err != nil {
+				return fmt.Errorf("gif: can't read image descriptor: %s", err)
+			}
+			d.interlaced = d.tmp[8]&fInterlace != 0
+			return nil
+		default:
+			return fmt.Errorf("gif: unknown block type: 0x%.2x", d.tmp[0])
+		}
+	}
+}
+
+// readExtension reads an extension block, the introducer of which has
+// already been consumed.
+func (d *gifdecoder) readExtension(r io.Reader) error {
+	if err := readFull(r, d.tmp[:1]); err != nil {
+		return fmt.Errorf("gif: reading extension: %v", err)
+	}
+	if d.tmp[0] == eGraphicControl {
+		if err := readFull(r, d.tmp[:6]); err != nil {
+			return fmt.Errorf("gif: can't read graphic control: %s", err)
+		}
+		if d.tmp[0] != 4 || d.tmp[5] != 0 {
+			return fmt.Errorf("gif: invalid graphic control extension block size: %d", d.tmp[0])
+		}
+		d.transparent = d.tmp[1]&gcTransparentColorSet != 0
+		d.delay = int(d.tmp[2]) | int(d.tmp[3])<<8
+		return nil
+	}
+	if d.tmp[0] == eApplication {
+		if err := readFull(r, d.tmp[:1]); err != nil {
+			return fmt.Errorf("gif: reading extension: %v", err)
+		}
+		n := int(d.tmp[0])
+		if err := readFull(r, d.tmp[:n]); err != nil {
+			return fmt.Errorf("gif: reading extension: %v", err)
+		}
+		// The looping extension holds a sub-block of ID 1 followed by the
+		// loop count.
+		if n == 11 && (string(d.tmp[:n]) == "NETSCAPE2.0" || string(d.tmp[:n]) == "ANIMEXTS1.0") {
+			if err := readFull(r, d.tmp[:1]); err != nil {
+				return fmt.Errorf("gif: reading extension: %v", err)
+			}
+			n = int(d.tmp[0])
+			if n == 0 {
+				return nil
+			}
+			if err := readFull(r, d.tmp[:n]); err != nil {
+				return fmt.Errorf("gif: reading extension: %v", err)
+			}
+			if n == 3 && d.tmp[0] == 1 {
+				d.loopCount = int(d.tmp[1]) | int(d.tmp[2])<<8
+				d.hasLoop = true
+			}
+		}
+	}
+	return d.skipBlocks(r)
+}
+
+// skipBlocks skips a sequence of data sub-blocks, up to and including the
+// zero-length block terminator.
+func (d *gifdecoder) skipBlocks(r io.Reader) error {
+	for {
+		if err := readFull(r, d.tmp[:1]); err != nil {
+			return fmt.Errorf("gif: reading data sub-block: %v", err)
+		}
+		n := int(d.tmp[0])
+		if n == 0 {
+			return nil
+		}
+		if err := readFull(r, d.tmp[:n]); err != nil {
+			return fmt.Errorf("gif: reading data sub-block: %v", err)
+		}
+	}
+}
+
+// decodegif returns the dimensions of a GIF image, along with what the
+// blocks before its first frame tell about it.
+func decodegif(r io.Reader) (Info, error) {
+	var d gifdecoder
+	if err := d.readHeaderAndScreenDescriptor(r); err != nil {
+		return Info{}, err
+	}
+	info := Info{Size: Size{d.width, d.height}, ColorModel: ColorPalette}
+	if d.headerFields&fColorTable != 0 {
+		info.BitDepth = int(d.headerFields&fColorTableBitsMask) + 1
+	}
+	// The size is already known, so a damaged stream ends the scan rather
+	// than failing the decode.
+	if d.readFirstImageDescriptor(r) == nil {
+		info.HasAlpha = d.transparent
+		info.Interlaced = d.interlaced
+	}
+	return info, nil
+}
+
+// readFrame reads the rest of an image: the image descriptor, whose
+// introducer has already been consumed, the local color table and the image
+// data.
+func (d *gifdecoder) readFrame(r io.Reader) error {
+	if err := readFull(r, d.tmp[:9]); err != nil {
+		return fmt.Errorf("gif: can't read image descriptor: %s", err)
+	}
+	if fields := d.tmp[8]; fields&fColorTable != 0 {
+		n := 3 * (1 << (1 + uint(fields&fColorTableBitsMask)))
+		if err := readFull(r, d.tmp[:n]); err != nil {
+			return fmt.Errorf("gif: reading color table: %s", err)
+		}
+	}
+	// Skip the LZW minimum code size, then the data.
+	if err := readFull(r, d.tmp[:1]); err != nil {
+		return fmt.Errorf("gif: reading image data: %v", err)
+	}
+	return d.skipBlocks(r)
+}
+
+// gifAnimation walks all the blocks of a GIF image, counting its frames and
+// adding up their delays.
+func gifAnimation(r io.Reader) (Animation, error) {
+	var d gifdecoder
+	if err := d.readHeaderAndScreenDescriptor(r); err != nil {
+		return Animation{}, err
+	}
+	if d.headerFields&fColorTable != 0 {
+		n := 3 * (1 << (1 + uint(d.headerFields&fColorTableBitsMask)))
+		if err := readFull(r, d.tmp[:n]); err != nil {
+			return Animation{}, fmt.Errorf("gif: reading color table: %s", err)
+		}
+	}
+	var anim Animation
+	for {
+		if err := readFull(r, d.tmp[:1]); err != nil {
+			return Animation{}, fmt.Errorf("gif: reading frames: %v", err)
+		}
+		switch d.tmp[0] {
+		case sExtension:
+			if err := d.readExtension(r); err != nil {
+				return Animation{}, err
+			}
+		case sImageDescriptor:
+			if err := d.readFrame(r); err != nil {
+				return Animation{}, err
+			}
+			anim.Frames++
+			anim.Duration += time.Duration(d.delay) * 10 * time.Millisecond
+			// A Graphic Control Extension only applies to the image that
+			// follows it.
+			d.delay = 0
+		case sTrailer:
+			anim.Animated = anim.Frames > 1
+			// Without the looping extension, the animation plays once.
+			// Otherwise it repeats as many times as the count says after
+			// the first play, with 0 meaning forever.
+			anim.LoopCount = 1
+			if d.hasLoop {
+				anim.LoopCount = 0
+				if d.loopCount > 0 {
+					anim.LoopCount = d.loopCount + 1
+				}
+			}
+			return anim, nil
+		default:
+			return Animation{}, fmt.Errorf("gif: unknown block type: 0x%.2x", d.tmp[0])
+		}
+	}
+}
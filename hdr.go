@@ -0,0 +1,101 @@
+// Radiance HDR files, described in the Radiance reference manual
+// (https://radsite.lbl.gov/radiance/refer/filefmts.pdf), start with a text
+// header ended by a blank line, followed by a resolution string such as
+// "-Y 480 +X 640". Its first axis is the one along which the scanlines
+// follow each other, and the sign of each axis its direction.
+
+package imgsz
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	hdrHeader     = "#?RADIANCE"
+	hdrHeaderRGBE = "#?RGBE"
+
+	hdrMaxHeader = 64 << 10
+)
+
+// hdrOrientations maps the signs and axes of a resolution string to the
+// EXIF Orientation that brings its scanlines upright. Radiance's Y axis
+// points up, so "-Y" scanlines run from the top down.
+var hdrOrientations = map[string]int{
+	"-Y+X": 1,
+	"-Y-X": 2,
+	"+Y-X": 3,
+	"+Y+X": 4,
+	"+X-Y": 5,
+	"-X-Y": 6,
+	"-X+Y": 7,
+	"+X+Y": 8,
+}
+
+// decodehdr returns the dimensions of a Radiance HDR image, and the
+// orientation that its resolution string gives.
+func decodehdr(r io.Reader) (Info, error) {
+	br := bufio.NewReader(r)
+	info := Info{
+		SampleFormat: SampleFloat,
+		ColorModel:   ColorRGB,
+		ColorSpace:   ColorSpaceLinear,
+		Channels:     3,
+		Frames:       1,
+	}
+	read := 0
+	for first := true; ; first = false {
+		b, err := br.ReadSlice('\n')
+		switch err {
+		case nil:
+		case bufio.ErrBufferFull:
+			return Info{}, FormatError("Radiance header line too long")
+		case io.EOF:
+			return Info{}, FormatError("missing Radiance resolution string")
+		default:
+			return Info{}, err
+		}
+		if read += len(b); read > hdrMaxHeader {
+			return Info{}, FormatError("Radiance header too long")
+		}
+		line := strings.TrimRight(string(b), "\r\n")
+		if first {
+			if line != hdrHeader && line != hdrHeaderRGBE {
+				return Info{}, FormatError("missing Radiance signature")
+			}
+			continue
+		}
+		if line == "" {
+			break
+		}
+		if strings.TrimSpace(line) == "FORMAT=32-bit_rle_xyze" {
+			// CIE XYZ has no ColorModel.
+			info.ColorModel = ColorUnknown
+		}
+	}
+
+	// The resolution string may end the stream.
+	b, err := br.ReadSlice('\n')
+	if err != nil && (err != io.EOF || len(b) == 0) {
+		if err == io.EOF || err == bufio.ErrBufferFull {
+			err = FormatError("bad Radiance resolution string")
+		}
+		return Info{}, err
+	}
+	f := strings.Fields(string(b))
+	if len(f) != 4 {
+		return Info{}, FormatError("bad Radiance resolution string")
+	}
+	o, ok := hdrOrientations[f[0]+f[2]]
+	n, err1 := strconv.ParseUint(f[1], 10, 31)
+	m, err2 := strconv.ParseUint(f[3], 10, 31)
+	if !ok || err1 != nil || err2 != nil || n == 0 || m == 0 {
+		return Info{}, FormatError("bad Radiance resolution string")
+	}
+	// The stored image has n scanlines of m pixels.
+	info.Size = Size{int(m), int(n)}
+	info.Orientation = o
+	return info, nil
+}
@@ -0,0 +1,593 @@
+// HEIF (ISO/IEC 23008-12) stores still images and image sequences in the
+// box structure of the ISO base media file format (ISO/IEC 14496-12). Both
+// HEIC and AVIF are HEIF files, differing only in the codec of the items.
+
+package imgsz
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+const maxBoxSize = 16 << 20 // 16M, the largest meta or moov box we buffer.
+
+var (
+	fccAuxC = fourCC{'a', 'u', 'x', 'C'}
+	fccAuxl = fourCC{'a', 'u', 'x', 'l'}
+	fccClap = fourCC{'c', 'l', 'a', 'p'}
+	fccFtyp = fourCC{'f', 't', 'y', 'p'}
+	fccImir = fourCC{'i', 'm', 'i', 'r'}
+	fccIref = fourCC{'i', 'r', 'e', 'f'}
+	fccIpco = fourCC{'i', 'p', 'c', 'o'}
+	fccIpma = fourCC{'i', 'p', 'm', 'a'}
+	fccIprp = fourCC{'i', 'p', 'r', 'p'}
+	fccIrot = fourCC{'i', 'r', 'o', 't'}
+	fccIspe = fourCC{'i', 's', 'p', 'e'}
+	fccMeta = fourCC{'m', 'e', 't', 'a'}
+	fccMoov = fourCC{'m', 'o', 'o', 'v'}
+	fccPitm = fourCC{'p', 'i', 't', 'm'}
+	fccPixi = fourCC{'p', 'i', 'x', 'i'}
+	fccTkhd = fourCC{'t', 'k', 'h', 'd'}
+	fccTrak = fourCC{'t', 'r', 'a', 'k'}
+)
+
+// heifAlphaURNs are the auxC types of an alpha plane, for AVIF and HEIC.
+var heifAlphaURNs = []string{
+	"urn:mpeg:mpegB:cicp:systems:auxiliary:alpha",
+	"urn:mpeg:hevc:2015:auxid:1",
+}
+
+// ftypSniffer returns a sniff function that reports whether the stream
+// starts with an ftyp box listing one of brands as its major brand or as
+// a compatible brand.
+func ftypSniffer(brands ...string) func([]byte) bool {
+	return func(b []byte) bool {
+		if len(b) < 16 || string(b[4:8]) != "ftyp" {
+			return false
+		}
+		n := int(binary.BigEndian.Uint32(b[0:4]))
+		if n < 16 {
+			return false
+		}
+		if n > len(b) {
+			n = len(b)
+		}
+		for i := 8; i+4 <= n; i += 4 {
+			if i == 12 {
+				// Skip the minor version.
+				continue
+			}
+			for _, brand := range brands {
+				if string(b[i:i+4]) == brand {
+					return true
+				}
+			}
+		}
+		return false
+	}
+}
+
+// readBoxHeader reads a box header from r and returns the box type and the
+// length of its payload. A length of -1 means that the box extends to the
+// end of the stream. It returns io.EOF if there are no more boxes.
+func readBoxHeader(r io.Reader) (typ fourCC, n int64, err error) {
+	var buf [16]byte
+	if _, err = io.ReadFull(r, buf[:8]); err != nil {
+		return
+	}
+	copy(typ[:], buf[4:8])
+	size := uint64(binary.BigEndian.Uint32(buf[0:4]))
+	hdr := uint64(8)
+	switch size {
+	case 0:
+		return typ, -1, nil
+	case 1:
+		if err = readFull(r, buf[8:16]); err != nil {
+			return
+		}
+		size = binary.BigEndian.Uint64(buf[8:16])
+		hdr = 16
+	}
+	if size < hdr || size-hdr > 1<<62 {
+		return typ, 0, FormatError("bad box size")
+	}
+	return typ, int64(size - hdr), nil
+}
+
+// readBox reads a box payload of length n, as returned by readBoxHeader.
+func readBox(r io.Reader, n int64) ([]byte, error) {
+	if n < 0 {
+		b, err := io.ReadAll(io.LimitReader(r, maxBoxSize+1))
+		if err == nil && len(b) > maxBoxSize {
+			err = UnsupportedError("box too large")
+		}
+		return b, err
+	}
+	if n > maxBoxSize {
+		return nil, UnsupportedError("box too large")
+	}
+	b := make([]byte, n)
+	return b, readFull(r, b)
+}
+
+// nextBox splits the first box off b, returning its type, its payload and the
+// bytes that follow it.
+func nextBox(b []byte) (typ fourCC, payload, rest []byte, err error) {
+	if len(b) < 8 {
+		return typ, nil, nil, FormatError("short box header")
+	}
+	copy(typ[:], b[4:8])
+	size := uint64(binary.BigEndian.Uint32(b[0:4]))
+	hdr := uint64(8)
+	switch size {
+	case 0:
+		size = uint64(len(b))
+	case 1:
+		if len(b) < 16 {
+			return typ, nil, nil, FormatError("short box header")
+		}
+		size = binary.BigEndian.Uint64(b[8:16])
+		hdr = 16
+	}
+	if size < hdr || size > uint64(len(b)) {
+		return typ, nil, nil, FormatError("bad box size")
+	}
+	return typ, b[hdr:size], b[size:], nil
+}
+
+// A heifProperty is an item property stored in the ipco box.
+type heifProperty struct {
+	typ  fourCC
+	data []byte
+}
+
+type heifdecoder struct {
+	primary    uint32
+	hasPrimary bool
+	props      []heifProperty
+	// assoc maps item IDs to the 1-based ipco indexes of their properties,
+	// in the order they are listed by ipma.
+	assoc map[uint32][]int
+	// auxl maps item IDs to the items they are auxiliary images of.
+	auxl map[uint32][]uint32
+	// sequence reports an image sequence brand in ftyp.
+	sequence bool
+}
+
+// hasBrand reports whether the payload of an ftyp box lists brand.
+func hasBrand(ftyp []byte, brand string) bool {
+	for i := 0; i+4 <= len(ftyp); i += 4 {
+		if i != 4 && string(ftyp[i:i+4]) == brand {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *heifdecoder) parseMeta(b []byte) error {
+	if len(b) < 4 {
+		return FormatError("short meta box")
+	}
+	// Skip the version and flags.
+	b = b[4:]
+	for len(b) > 0 {
+		typ, p, rest, err := nextBox(b)
+		if err != nil {
+			return err
+		}
+		b = rest
+		switch typ {
+		case fccPitm:
+			if err := d.parsePitm(p); err != nil {
+				return err
+			}
+		case fccIprp:
+			if err := d.parseIprp(p); err != nil {
+				return err
+			}
+		case fccIref:
+			if err := d.parseIref(p); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// parseIref records the auxl item references, which tie alpha planes to
+// their master images.
+func (d *heifdecoder) parseIref(b []byte) error {
+	if len(b) < 4 {
+		return FormatError("short iref box")
+	}
+	idLen := 2
+	if b[0] != 0 {
+		idLen = 4
+	}
+	readID := func(p []byte) uint32 {
+		if idLen == 2 {
+			return uint32(binary.BigEndian.Uint16(p))
+		}
+		return binary.BigEndian.Uint32(p)
+	}
+	b = b[4:]
+	for len(b) > 0 {
+		typ, p, rest, err := nextBox(b)
+		if err != nil {
+			return err
+		}
+		b = rest
+		if typ != fccAuxl {
+			continue
+		}
+		if len(p) < idLen+2 {
+			return FormatError("short iref box")
+		}
+		from := readID(p)
+		n := int(binary.BigEndian.Uint16(p[idLen : idLen+2]))
+		p = p[idLen+2:]
+		if len(p) < n*idLen {
+			return FormatError("short iref box")
+		}
+		if d.auxl == nil {
+			d.auxl = make(map[uint32][]uint32)
+		}
+		for i := 0; i < n; i++ {
+			d.auxl[from] = append(d.auxl[from], readID(p[i*idLen:]))
+		}
+	}
+	return nil
+}
+
+// property returns the first property of type typ associated with item id.
+func (d *heifdecoder) property(id uint32, typ fourCC) []byte {
+	for _, i := range d.assoc[id] {
+		if i != 0 && i <= len(d.props) && d.props[i-1].typ == typ {
+			return d.props[i-1].data
+		}
+	}
+	return nil
+}
+
+// hasAlpha reports whether an alpha plane is an auxiliary image of the
+// primary item.
+func (d *heifdecoder) hasAlpha() bool {
+	for from, to := range d.auxl {
+		for _, id := range to {
+			if id != d.primary {
+				continue
+			}
+			// The auxC payload is a full box header followed by a
+			// null-terminated URN.
+			p := d.property(from, fccAuxC)
+			if len(p) < 4 {
+				continue
+			}
+			urn := p[4:]
+			if i := bytes.IndexByte(urn, 0); i >= 0 {
+				urn = urn[:i]
+			}
+			for _, alpha := range heifAlphaURNs {
+				if string(urn) == alpha {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func (d *heifdecoder) info() (Info, error) {
+	stored, display, orientation, err := d.geometry()
+	if err != nil {
+		return Info{}, err
+	}
+	info := Info{
+		Size:        display,
+		HasAlpha:    d.hasAlpha(),
+		Animated:    d.sequence,
+		Orientation: orientation,
+		Stored:      stored,
+		Display:     display,
+	}
+	if !d.sequence {
+		info.Frames = 1
+	}
+	// The pixi payload is a full box header, the number of channels and
+	// the bit depth of each.
+	if p := d.property(d.primary, fccPixi); len(p) > 5 {
+		info.BitDepth = int(p[5])
+		if p[4] == 1 {
+			info.ColorModel = ColorGray
+		} else {
+			info.ColorModel = ColorYCbCr
+		}
+	}
+	return info, nil
+}
+
+func (d *heifdecoder) parsePitm(p []byte) error {
+	switch {
+	case len(p) >= 6 && p[0] == 0:
+		d.primary = uint32(binary.BigEndian.Uint16(p[4:6]))
+	case len(p) >= 8:
+		d.primary = binary.BigEndian.Uint32(p[4:8])
+	default:
+		return FormatError("short pitm box")
+	}
+	d.hasPrimary = true
+	return nil
+}
+
+func (d *heifdecoder) parseIprp(b []byte) error {
+	for len(b) > 0 {
+		typ, p, rest, err := nextBox(b)
+		if err != nil {
+			return err
+		}
+		b = rest
+		switch typ {
+		case fccIpco:
+			for len(p) > 0 {
+				ptyp, data, prest, err := nextBox(p)
+				if err != nil {
+					return err
+				}
+				p = prest
+				d.props = append(d.props, heifProperty{ptyp, data})
+			}
+		case fccIpma:
+			if err := d.parseIpma(p); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (d *heifdecoder) parseIpma(p []byte) error {
+	if len(p) < 8 {
+		return FormatError("short ipma box")
+	}
+	version, flags := p[0], p[3]
+	count := binary.BigEndian.Uint32(p[4:8])
+	p = p[8:]
+	if d.assoc == nil {
+		d.assoc = make(map[uint32][]int)
+	}
+	for i := uint32(0); i < count; i++ {
+		var id uint32
+		if version < 1 {
+			if len(p) < 3 {
+				return FormatError("short ipma box")
+			}
+			id = uint32(binary.BigEndian.Uint16(p[0:2]))
+			p = p[2:]
+		} else {
+			if len(p) < 5 {
+				return FormatError("short ipma box")
+			}
+			id = binary.BigEndian.Uint32(p[0:4])
+			p = p[4:]
+		}
+		n := int(p[0])
+		p = p[1:]
+		for j := 0; j < n; j++ {
+			// The top bit of each association is the "essential" flag.
+			var index int
+			if flags&1 != 0 {
+				if len(p) < 2 {
+					return FormatError("short ipma box")
+				}
+				index = int(binary.BigEndian.Uint16(p[0:2]) & 0x7fff)
+				p = p[2:]
+			} else {
+				if len(p) < 1 {
+					return FormatError("short ipma box")
+				}
+				index = int(p[0] & 0x7f)
+				p = p[1:]
+			}
+			d.assoc[id] = append(d.assoc[id], index)
+		}
+	}
+	return nil
+}
+
+// heifOrientations maps the matrices that the irot and imir properties
+// compose to, acting on (x, y) with y pointing down, to EXIF orientations.
+var heifOrientations = map[[4]int]int{
+	{1, 0, 0, 1}:   1,
+	{-1, 0, 0, 1}:  2,
+	{-1, 0, 0, -1}: 3,
+	{1, 0, 0, -1}:  4,
+	{0, 1, 1, 0}:   5,
+	{0, -1, 1, 0}:  6,
+	{0, -1, -1, 0}: 7,
+	{0, 1, -1, 0}:  8,
+}
+
+// mul returns the product of the 2x2 matrices a and b, in row-major order.
+func mul(a, b [4]int) [4]int {
+	return [4]int{
+		a[0]*b[0] + a[1]*b[2], a[0]*b[1] + a[1]*b[3],
+		a[2]*b[0] + a[3]*b[2], a[2]*b[1] + a[3]*b[3],
+	}
+}
+
+// geometry returns the coded size of the primary item, its size as a viewer
+// displays it and the EXIF orientation equivalent to its irot and imir
+// properties. The transformative properties are applied in the order that
+// ipma lists them.
+func (d *heifdecoder) geometry() (stored, display Size, orientation int, err error) {
+	if !d.hasPrimary {
+		return Size{}, Size{}, 0, FormatError("missing primary item")
+	}
+	var (
+		seen, transformed bool
+		m                 = [4]int{1, 0, 0, 1}
+	)
+	for _, i := range d.assoc[d.primary] {
+		// Index 0 means that no property is associated.
+		if i == 0 || i > len(d.props) {
+			continue
+		}
+		p := d.props[i-1].data
+		switch d.props[i-1].typ {
+		case fccIspe:
+			if len(p) < 12 {
+				return Size{}, Size{}, 0, FormatError("short ispe box")
+			}
+			stored.Width = int(binary.BigEndian.Uint32(p[4:8]))
+			stored.Height = int(binary.BigEndian.Uint32(p[8:12]))
+			display = stored
+			seen = true
+		case fccClap:
+			if len(p) < 32 {
+				return Size{}, Size{}, 0, FormatError("short clap box")
+			}
+			wN, wD := binary.BigEndian.Uint32(p[0:4]), binary.BigEndian.Uint32(p[4:8])
+			hN, hD := binary.BigEndian.Uint32(p[8:12]), binary.BigEndian.Uint32(p[12:16])
+			if wD == 0 || hD == 0 {
+				return Size{}, Size{}, 0, FormatError("bad clap box")
+			}
+			display.Width, display.Height = int(wN/wD), int(hN/hD)
+		case fccIrot:
+			if len(p) < 1 {
+				return Size{}, Size{}, 0, FormatError("short irot box")
+			}
+			// The angle is in units of 90 degrees anti-clockwise.
+			transformed = true
+			for a := p[0] & 3; a > 0; a-- {
+				m = mul([4]int{0, 1, -1, 0}, m)
+			}
+			if p[0]&1 != 0 {
+				display.Width, display.Height = display.Height, display.Width
+			}
+		case fccImir:
+			if len(p) < 1 {
+				return Size{}, Size{}, 0, FormatError("short imir box")
+			}
+			// Mirroring does not change the dimensions. Axis 0 is
+			// vertical, so that it flips left and right.
+			transformed = true
+			if p[0]&1 == 0 {
+				m = mul([4]int{-1, 0, 0, 1}, m)
+			} else {
+				m = mul([4]int{1, 0, 0, -1}, m)
+			}
+		}
+	}
+	if !seen {
+		return Size{}, Size{}, 0, FormatError("missing ispe property")
+	}
+	if transformed {
+		orientation = heifOrientations[m]
+	}
+	return stored, display, orientation, nil
+}
+
+// parseMoov returns the size of the first visual track in a moov box. It is
+// used for image sequences that carry no meta box.
+func parseMoov(b []byte) (Size, error) {
+	for len(b) > 0 {
+		typ, p, rest, err := nextBox(b)
+		if err != nil {
+			return Size{}, err
+		}
+		b = rest
+		if typ != fccTrak {
+			continue
+		}
+		for len(p) > 0 {
+			ttyp, t, trest, err := nextBox(p)
+			if err != nil {
+				return Size{}, err
+			}
+			p = trest
+			if ttyp != fccTkhd {
+				continue
+			}
+			// The width and height are 16.16 fixed-point numbers that
+			// follow the version dependent timing fields and the matrix.
+			off := 76
+			if len(t) > 0 && t[0] == 1 {
+				off = 88
+			}
+			if len(t) < off+8 {
+				return Size{}, FormatError("short tkhd box")
+			}
+			w := binary.BigEndian.Uint32(t[off:off+4]) >> 16
+			h := binary.BigEndian.Uint32(t[off+4:off+8]) >> 16
+			if w != 0 && h != 0 {
+				return Size{int(w), int(h)}, nil
+			}
+		}
+	}
+	return Size{}, nil
+}
+
+// decodeheif returns the dimensions of the primary image of a HEIF file
+// without decoding the entire image.
+func decodeheif(r io.Reader) (Info, error) {
+	var (
+		d     heifdecoder
+		track Size
+	)
+	for first := true; ; first = false {
+		typ, n, err := readBoxHeader(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Info{}, err
+		}
+		if first && typ != fccFtyp {
+			return Info{}, FormatError("missing ftyp box")
+		}
+		switch typ {
+		case fccFtyp:
+			b, err := readBox(r, n)
+			if err != nil {
+				return Info{}, err
+			}
+			d.sequence = hasBrand(b, "avis") || hasBrand(b, "msf1")
+		case fccMeta:
+			b, err := readBox(r, n)
+			if err != nil {
+				return Info{}, err
+			}
+			if err := d.parseMeta(b); err != nil {
+				return Info{}, err
+			}
+			return d.info()
+		case fccMoov:
+			b, err := readBox(r, n)
+			if err != nil {
+				return Info{}, err
+			}
+			if track, err = parseMoov(b); err != nil {
+				return Info{}, err
+			}
+		default:
+			if n < 0 {
+				break
+			}
+			if _, err := io.CopyN(io.Discard, r, n); err != nil {
+				if err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				return Info{}, err
+			}
+		}
+		if n < 0 {
+			// The box extended to the end of the stream.
+			break
+		}
+	}
+	if track != (Size{}) {
+		return Info{Size: track, Animated: true}, nil
+	}
+	return Info{}, FormatError("missing meta box")
+}
@@ -0,0 +1,181 @@
+// An ICNS file is a sequence of typed chunks, each holding one
+// representation of a macOS icon. Older types hold raw or run-length encoded
+// pixels whose size is implied by the type, while newer ones embed a PNG or
+// JPEG 2000 image.
+
+package imgsz
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+const icnsHeader = "icns"
+
+// An icnsType describes the representations of an ICNS chunk type. Types
+// that may embed PNG or JPEG 2000 data have png set; a format of "" means
+// that they must.
+type icnsType struct {
+	width, height, scale, bpp int
+	format                    string
+	png                       bool
+}
+
+var icnsTypes = map[string]icnsType{
+	"ICON": {32, 32, 1, 1, "mono", false},
+	"ICN#": {32, 32, 1, 1, "mono", false},
+	"icm#": {16, 12, 1, 1, "mono", false},
+	"icm4": {16, 12, 1, 4, "palette", false},
+	"icm8": {16, 12, 1, 8, "palette", false},
+	"ics#": {16, 16, 1, 1, "mono", false},
+	"ics4": {16, 16, 1, 4, "palette", false},
+	"ics8": {16, 16, 1, 8, "palette", false},
+	"is32": {16, 16, 1, 24, "rgb", false},
+	"icl4": {32, 32, 1, 4, "palette", false},
+	"icl8": {32, 32, 1, 8, "palette", false},
+	"il32": {32, 32, 1, 24, "rgb", false},
+	"ich#": {48, 48, 1, 1, "mono", false},
+	"ich4": {48, 48, 1, 4, "palette", false},
+	"ich8": {48, 48, 1, 8, "palette", false},
+	"ih32": {48, 48, 1, 24, "rgb", false},
+	"it32": {128, 128, 1, 24, "rgb", false},
+	"icp4": {16, 16, 1, 24, "rgb", true},
+	"icp5": {32, 32, 1, 24, "rgb", true},
+	"icp6": {64, 64, 1, 0, "", true},
+	"ic04": {16, 16, 1, 32, "argb", true},
+	"ic05": {32, 32, 1, 32, "argb", true},
+	"ic07": {128, 128, 1, 0, "", true},
+	"ic08": {256, 256, 1, 0, "", true},
+	"ic09": {512, 512, 1, 0, "", true},
+	"ic10": {1024, 1024, 2, 0, "", true},
+	"ic11": {32, 32, 2, 0, "", true},
+	"ic12": {64, 64, 2, 0, "", true},
+	"ic13": {256, 256, 2, 0, "", true},
+	"ic14": {512, 512, 2, 0, "", true},
+	"icsb": {18, 18, 1, 32, "argb", true},
+	"icsB": {36, 36, 2, 0, "", true},
+	"sb24": {24, 24, 1, 0, "", true},
+	"SB24": {48, 48, 2, 0, "", true},
+}
+
+// icnsIcon returns the representation held by the chunk of type t whose
+// data is in r, of length n.
+func icnsIcon(t icnsType, r io.ReaderAt, off, n int64) (icon, error) {
+	var head [12]byte
+	m, _ := r.ReadAt(head[:], off)
+	b := head[:m]
+	if t.png {
+		var (
+			info Info
+			err  error
+		)
+		switch {
+		case len(b) >= len(pngHeader) && string(b[:len(pngHeader)]) == pngHeader:
+			info, err = decodepng(io.NewSectionReader(r, off, n))
+			if err != nil {
+				return icon{}, err
+			}
+			return icon{
+				IconEntry: IconEntry{
+					Size:         info.Size,
+					BitsPerPixel: info.BitDepth * info.Channels,
+					Format:       "png",
+					Scale:        t.scale,
+				},
+				info: info,
+			}, nil
+		case len(b) >= len(jp2Header) && string(b[:len(jp2Header)]) == jp2Header:
+			info, err = decodejp2(io.NewSectionReader(r, off, n))
+			if err != nil {
+				return icon{}, err
+			}
+			return icon{
+				IconEntry: IconEntry{
+					Size:         info.Size,
+					BitsPerPixel: info.BitDepth * info.Channels,
+					Format:       "jp2",
+					Scale:        t.scale,
+				},
+				info: info,
+			}, nil
+		case t.format == "argb" && len(b) >= 4 && string(b[:4]) != "ARGB":
+			return icon{}, FormatError("bad ARGB icon data")
+		case t.format == "":
+			return icon{}, FormatError("icon is neither PNG nor JPEG 2000")
+		}
+	}
+
+	ic := icon{
+		IconEntry: IconEntry{
+			Size:         Size{t.width, t.height},
+			BitsPerPixel: t.bpp,
+			Format:       t.format,
+			Scale:        t.scale,
+		},
+	}
+	ic.info = Info{Size: ic.Size, BitDepth: 8, Channels: 3, ColorModel: ColorRGB, Frames: 1}
+	switch t.format {
+	case "mono":
+		// The bitmap is followed by its mask.
+		ic.info = Info{Size: ic.Size, BitDepth: 1, Channels: 1, ColorModel: ColorGray, HasAlpha: true, Frames: 1}
+	case "palette":
+		ic.info = Info{Size: ic.Size, BitDepth: t.bpp, Channels: 1, ColorModel: ColorPalette, Frames: 1}
+	case "argb":
+		ic.info.Channels, ic.info.HasAlpha = 4, true
+	}
+	return ic, nil
+}
+
+// parseICNS walks the chunks of an ICNS file and returns the icon
+// representations among them, leaving out masks and metadata.
+func parseICNS(r io.ReaderAt) ([]icon, error) {
+	var b [8]byte
+	if _, err := r.ReadAt(b[:], 0); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	if string(b[:4]) != icnsHeader {
+		return nil, FormatError("missing icns header")
+	}
+	total := int64(binary.BigEndian.Uint32(b[4:8]))
+	var icons []icon
+	for off := int64(8); off+8 <= total; {
+		if _, err := r.ReadAt(b[:], off); err != nil {
+			// Some writers get the total length wrong.
+			if err == io.EOF && len(icons) > 0 {
+				break
+			}
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		n := int64(binary.BigEndian.Uint32(b[4:8]))
+		if n < 8 {
+			return nil, FormatError("bad icns chunk length")
+		}
+		if t, ok := icnsTypes[string(b[:4])]; ok {
+			ic, err := icnsIcon(t, r, off+8, n-8)
+			if err != nil {
+				return nil, err
+			}
+			icons = append(icons, ic)
+		}
+		off += n
+	}
+	if len(icons) == 0 {
+		return nil, FormatError("no icon images")
+	}
+	return icons, nil
+}
+
+// decodeicns returns the largest representation of an ICNS file.
+func decodeicns(r io.Reader) (Info, error) {
+	icons, err := parseICNS(newReaderAt(r))
+	if err != nil {
+		return Info{}, err
+	}
+	return largestIcon(icons), nil
+}
@@ -0,0 +1,231 @@
+// ICO and CUR files are a directory of images, each either a PNG file or a
+// DIB without its BMP file header. The format is described at
+// https://learn.microsoft.com/en-us/previous-versions/ms997538(v=msdn.10).
+
+package imgsz
+
+import (
+	"image"
+	"io"
+)
+
+const (
+	icoHeader = "\x00\x00\x01\x00"
+	curHeader = "\x00\x00\x02\x00"
+
+	icoDirEntryLen = 16
+	icoMaxOffset   = 1 << 28 // Far beyond the images of any real icon file.
+)
+
+// icoSniffer returns a sniff function for the ICO or CUR header magic. The
+// image count that follows must not be zero: an uncompressed TGA image
+// without an image ID also starts with one of the headers.
+func icoSniffer(magic string) func([]byte) bool {
+	return func(b []byte) bool {
+		return len(b) >= 6 && string(b[:4]) == magic && readUint16(b[4:6]) != 0
+	}
+}
+
+// An IconEntry describes one image of an icon or cursor file.
+type IconEntry struct {
+	Size
+	// BitsPerPixel is the number of bits per pixel, all channels included,
+	// or 0 if it is unknown.
+	BitsPerPixel int
+	// Format is the format of the image data: "png", "bmp" for the DIB of
+	// an ICO or CUR file, or the name of the encoding for other formats.
+	Format string
+	// Scale is the number of pixels per point: 2 for the retina
+	// representations of ICNS files, and 1 otherwise.
+	Scale int
+	// Hotspot is the hotspot of a cursor, relative to its top-left corner.
+	Hotspot image.Point
+}
+
+// An icon is an entry of an icon file, together with the Info of its image.
+type icon struct {
+	IconEntry
+	info Info
+}
+
+// largestIcon returns the Info of the largest of icons, preferring the
+// deeper of two images of the same size.
+func largestIcon(icons []icon) Info {
+	best := icons[0]
+	for _, ic := range icons[1:] {
+		a, b := ic.Width*ic.Height, best.Width*best.Height
+		if a > b || a == b && ic.BitsPerPixel > best.BitsPerPixel {
+			best = ic
+		}
+	}
+	return best.info
+}
+
+// dibIcon checks the DIB header of an ICO image. Its height covers both the
+// color bitmap and the transparency mask that follows it.
+func dibIcon(b []byte) (icon, error) {
+	if len(b) < 40 {
+		return icon{}, FormatError("short icon DIB header")
+	}
+	if n := readUint32(b[0:4]); n != 40 && n != 108 && n != 124 {
+		return icon{}, FormatError("bad icon DIB header")
+	}
+	h := parseDIBHeader(b)
+	if h.width <= 0 || h.height <= 0 || h.planes > 1 {
+		return icon{}, FormatError("bad icon DIB header")
+	}
+	ic := icon{
+		IconEntry: IconEntry{
+			Size:         Size{h.width, h.height / 2},
+			BitsPerPixel: int(h.bpp),
+			Format:       "bmp",
+			Scale:        1,
+		},
+	}
+	// Whatever the bit depth, the AND mask can make pixels transparent.
+	ic.info = Info{Size: ic.Size, BitDepth: 8, ColorModel: ColorRGB, HasAlpha: true, Frames: 1}
+	switch h.bpp {
+	case 1, 2, 4, 8:
+		ic.info.BitDepth = int(h.bpp)
+		ic.info.ColorModel = ColorPalette
+	case 16, 24, 32:
+	default:
+		return icon{}, FormatError("bad icon bit depth")
+	}
+	return ic, nil
+}
+
+// pngIcon checks the header of a PNG image embedded in an icon file.
+func pngIcon(r io.Reader) (icon, error) {
+	info, err := decodepng(r)
+	if err != nil {
+		return icon{}, err
+	}
+	return icon{
+		IconEntry: IconEntry{
+			Size:         info.Size,
+			BitsPerPixel: info.BitDepth * info.Channels,
+			Format:       "png",
+			Scale:        1,
+		},
+		info: info,
+	}, nil
+}
+
+// parseICO reads the directory of an ICO or CUR file, and checks the header
+// of every image against it.
+func parseICO(r io.ReaderAt) ([]icon, error) {
+	var b [6]byte
+	if _, err := r.ReadAt(b[:], 0); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	typ, count := readUint16(b[2:4]), int(readUint16(b[4:6]))
+	if readUint16(b[0:2]) != 0 || typ != 1 && typ != 2 {
+		return nil, FormatError("bad icon header")
+	}
+	if count == 0 {
+		return nil, FormatError("no icon images")
+	}
+	dir, err := safeReadAt(r, uint64(count*icoDirEntryLen), 6)
+	if err != nil {
+		return nil, err
+	}
+	icons := make([]icon, 0, count)
+	for i := 0; i < count; i++ {
+		e := dir[i*icoDirEntryLen : (i+1)*icoDirEntryLen]
+		n, off := readUint32(e[8:12]), readUint32(e[12:16])
+		if off < uint32(6+len(dir)) || off > icoMaxOffset {
+			return nil, FormatError("bad icon image offset")
+		}
+		// The header of the image tells its true size and format. A PNG
+		// header is 8 bytes long, followed by the 25 of the IHDR chunk,
+		// and a DIB header is at least 40 bytes long.
+		head := make([]byte, 40)
+		if m, err := r.ReadAt(head, int64(off)); m < len(head) {
+			if err == nil || err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		var ic icon
+		if string(head[:len(pngHeader)]) == pngHeader {
+			ic, err = pngIcon(io.NewSectionReader(r, int64(off), int64(n)))
+		} else {
+			ic, err = dibIcon(head)
+		}
+		if err != nil {
+			return nil, err
+		}
+		// A directory size of 256 also stands for the larger sizes that
+		// PNG images may have.
+		dirSize := iconDirSize(e[0], e[1])
+		if ic.Size != dirSize && (dirSize != Size{256, 256} || ic.Width < 256 || ic.Height < 256) {
+			return nil, FormatError("icon size does not match its directory entry")
+		}
+		if typ == 2 {
+			// Cursors keep their hotspot where icons keep their planes
+			// and bit count.
+			ic.Hotspot = image.Point{int(readUint16(e[4:6])), int(readUint16(e[6:8]))}
+		} else if ic.BitsPerPixel == 0 {
+			ic.BitsPerPixel = int(readUint16(e[6:8]))
+		}
+		icons = append(icons, ic)
+	}
+	return icons, nil
+}
+
+// iconDirSize returns the size that an icon directory records, in which 0
+// stands for 256.
+func iconDirSize(w, h byte) Size {
+	s := Size{int(w), int(h)}
+	if s.Width == 0 {
+		s.Width = 256
+	}
+	if s.Height == 0 {
+		s.Height = 256
+	}
+	return s
+}
+
+// decodeico returns the largest image of an ICO or CUR file.
+func decodeico(r io.Reader) (Info, error) {
+	icons, err := parseICO(newReaderAt(r))
+	if err != nil {
+		return Info{}, err
+	}
+	return largestIcon(icons), nil
+}
+
+// DecodeIcons returns every image of an ICO, CUR or ICNS file, in the order
+// in which the file lists them. The string returned is the format name.
+func DecodeIcons(r io.Reader) ([]IconEntry, string, error) {
+	return defaultDecoder.DecodeIcons(r)
+}
+
+// DecodeIcons is like the DecodeIcons function, for the formats of d.
+func (d *Decoder) DecodeIcons(r io.Reader) ([]IconEntry, string, error) {
+	rr, f, err := d.detect(r)
+	if err != nil {
+		return nil, f.name, err
+	}
+	var icons []icon
+	switch f.name {
+	case "ico", "cur":
+		icons, err = parseICO(newReaderAt(rr))
+	case "icns":
+		icons, err = parseICNS(newReaderAt(rr))
+	default:
+		return nil, f.name, UnsupportedError("icon entries of " + f.name)
+	}
+	if err != nil {
+		return nil, f.name, err
+	}
+	entries := make([]IconEntry, len(icons))
+	for i, ic := range icons {
+		entries[i] = ic.IconEntry
+	}
+	return entries, f.name, nil
+}
@@ -8,6 +8,7 @@ import (
 	"bufio"
 	"errors"
 	"io"
+	"strings"
 	"sync"
 	"sync/atomic"
 )
@@ -25,22 +26,306 @@ func (e UnsupportedError) Error() string { return "unsupported feature: " + stri
 // ErrFormat indicates that decoding encountered an unknown format.
 var ErrFormat = errors.New("image: unknown format")
 
+// A DisallowedFormatError reports that the input is in a format that the
+// Decoder recognizes but does not allow. It holds the format name.
+type DisallowedFormatError string
+
+func (e DisallowedFormatError) Error() string { return "disallowed format: " + string(e) }
+
 type Size struct {
 	Width, Height int
 }
 
-// A format holds an image format's name, magic header and how to decode it.
+// A ColorModel names how the samples of an image are interpreted.
+type ColorModel string
+
+const (
+	ColorUnknown ColorModel = ""
+	ColorGray    ColorModel = "gray"
+	ColorRGB     ColorModel = "rgb"
+	ColorPalette ColorModel = "palette"
+	ColorYCbCr   ColorModel = "ycbcr"
+	ColorCMYK    ColorModel = "cmyk"
+	ColorLab     ColorModel = "lab"
+)
+
+// A ColorSpace names how the samples of an image map to light.
+type ColorSpace string
+
+const (
+	ColorSpaceUnknown ColorSpace = ""
+	ColorSpaceSRGB    ColorSpace = "srgb"
+	ColorSpaceLinear  ColorSpace = "linear"
+)
+
+// A SampleFormat names how the bits of a sample encode its value.
+type SampleFormat string
+
+const (
+	SampleUnknown SampleFormat = ""
+	SampleUint    SampleFormat = "uint"
+	SampleInt     SampleFormat = "int"
+	SampleFloat   SampleFormat = "float"
+)
+
+// Info holds the dimensions of an image together with the other properties
+// that its decoder can read without decoding the pixels. Fields that a
+// format does not record are left as their zero value.
+type Info struct {
+	// Size is the size of the image. For DNG, it is that of the
+	// full-resolution image, cropped as the Raw size of DecodeRAW is.
+	Size
+	// BitDepth is the number of bits per sample.
+	BitDepth int
+	// Channels is the number of samples per pixel, alpha included.
+	Channels     int
+	SampleFormat SampleFormat
+	ColorModel   ColorModel
+	ColorSpace   ColorSpace
+	HasAlpha     bool
+	// Interlaced reports an interlaced PNG or GIF, or a progressive JPEG.
+	Interlaced bool
+	Animated   bool
+	// Frames is the number of frames, or 0 if counting them would mean
+	// reading the whole stream.
+	Frames int
+	// Orientation is the raw EXIF Orientation value, from 1 to 8, or 0 if
+	// the image carries none. For Radiance HDR, it is the value equivalent
+	// to the axis order of the resolution string. For an animated WebP
+	// image, whose EXIF data follows all of its frames, it is 0.
+	Orientation int
+	// Stored is the size of the pixel data as encoded, and Display is the
+	// size that a viewer shows once Orientation is applied. Size equals
+	// Stored, except for HEIF, whose Size already has its transformative
+	// properties applied and so equals Display. For OpenEXR, Stored is the
+	// data window and Display the display window.
+	Stored, Display Size
+}
+
+// A Magic is a signature found at a fixed offset from the start of an
+// encoded image. Its pattern may contain "?" wildcards that each match any
+// one byte.
+type Magic struct {
+	Offset  int
+	Pattern string
+}
+
+// A Format describes an image format to Register.
+type Format struct {
+	// Name is the name of the format, like "jpeg" or "png".
+	Name string
+	// Magics lists signatures that must all match for a stream to be taken
+	// for the format. The confidence of the match is one more than the
+	// number of bytes that they pin down, wildcards aside.
+	Magics []Magic
+	// Sniff, if non-nil, recognizes the format instead of Magics. It is
+	// given the bytes peeked from the start of the stream, which may be
+	// fewer than the peek limit, and returns its confidence that they start
+	// an image of the format, or 0 if they do not.
+	Sniff func(peek []byte) (confidence int)
+	// DecodeSize decodes the dimensions of an image.
+	DecodeSize func(io.Reader) (Size, error)
+}
+
+// A format holds an image format's name, signature and how to decode it.
 type format struct {
-	name, magic string
-	decodeSize  func(io.Reader) (Size, error)
+	name string
+	// magics must all match for the format to be recognized, with a
+	// confidence of confidence, unless sniff is non-nil.
+	magics     []Magic
+	confidence int
+	sniff      func([]byte) int
+	decodeInfo func(io.Reader) (Info, error)
 }
 
-// Formats is the list of registered formats.
-var (
-	formatsMu     sync.Mutex
-	atomicFormats atomic.Value
+// Confidences of the built-in formats that are not recognized by a magic.
+const (
+	// fallbackConfidence is that of formats without any signature, which
+	// any match of a magic beats.
+	fallbackConfidence = 1
+	// sniffConfidence is that of the sniff functions that check a
+	// signature of a few bytes.
+	sniffConfidence = 4
 )
 
+// DefaultPeekLimit is the number of bytes that format detection peeks at
+// from the start of a stream, until SetPeekLimit changes it.
+const DefaultPeekLimit = 512
+
+// A Decoder holds its own set of registered formats, and decodes the images
+// of those formats only. The package-level functions use a default Decoder,
+// which holds the built-in formats. A Decoder must not be copied after first
+// use.
+type Decoder struct {
+	peekLimit int64 // First, for 64-bit alignment.
+	mu        sync.Mutex
+	formats   atomic.Value // []format
+	policy    atomic.Value // formatPolicy
+}
+
+// A formatPolicy holds the format names that a Decoder allows and denies.
+// A nil allow map allows every format that is not denied.
+type formatPolicy struct {
+	allow, deny map[string]bool
+}
+
+var defaultDecoder = new(Decoder)
+
+// NewDecoder returns a Decoder holding a copy of the formats of the default
+// Decoder, as registered so far. If names are given, only the formats with
+// these names are copied.
+func NewDecoder(names ...string) *Decoder {
+	d := &Decoder{peekLimit: atomic.LoadInt64(&defaultDecoder.peekLimit)}
+	var formats []format
+	for _, f := range defaultDecoder.list() {
+		if len(names) == 0 || hasName(names, f.name) {
+			formats = append(formats, f)
+		}
+	}
+	d.formats.Store(formats)
+	return d
+}
+
+func hasName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// list returns the formats of d, which must not be modified.
+func (d *Decoder) list() []format {
+	formats, _ := d.formats.Load().([]format)
+	return formats
+}
+
+func (d *Decoder) add(f format) {
+	d.mu.Lock()
+	formats := d.list()
+	// Copy, as the old slice may be in use by sniff.
+	d.formats.Store(append(formats[:len(formats):len(formats)], f))
+	d.mu.Unlock()
+}
+
+// Register registers an image format with d. See the Register function.
+func (d *Decoder) Register(f Format) {
+	if f.Sniff != nil {
+		d.add(format{name: f.Name, sniff: f.Sniff, decodeInfo: sizeInfo(f.DecodeSize)})
+		return
+	}
+	d.add(magicFormat(f.Name, f.Magics, sizeInfo(f.DecodeSize)))
+}
+
+// RegisterFormatFunc registers an image format that has no magic prefix
+// with d. See the RegisterFormatFunc function.
+func (d *Decoder) RegisterFormatFunc(name string, validate func([]byte) bool, decodeSize func(io.Reader) (Size, error)) {
+	d.add(format{name: name, sniff: confidence(validate, fallbackConfidence), decodeInfo: sizeInfo(decodeSize)})
+}
+
+// Unregister removes every format named name from d, and reports whether
+// there was any.
+func (d *Decoder) Unregister(name string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var formats []format
+	for _, f := range d.list() {
+		if f.name != name {
+			formats = append(formats, f)
+		}
+	}
+	if len(formats) == len(d.list()) {
+		return false
+	}
+	d.formats.Store(formats)
+	return true
+}
+
+// List returns the names of the formats registered with d, in the order in
+// which they were first registered.
+func (d *Decoder) List() []string {
+	var names []string
+	for _, f := range d.list() {
+		if !hasName(names, f.name) {
+			names = append(names, f.name)
+		}
+	}
+	return names
+}
+
+// Allow restricts the formats that d decodes to those named, or lifts the
+// restriction if none are. Images in other formats are still recognized, so
+// that decoding them fails with a DisallowedFormatError naming their format
+// instead of ErrFormat, but their headers are not parsed.
+func (d *Decoder) Allow(names ...string) {
+	d.mu.Lock()
+	p := d.getPolicy()
+	p.allow = nameSet(names)
+	d.policy.Store(p)
+	d.mu.Unlock()
+}
+
+// Deny prevents d from decoding the formats named, replacing the ones that
+// an earlier call denied, like Allow does for the formats that it leaves
+// out. A format both allowed and denied is denied.
+func (d *Decoder) Deny(names ...string) {
+	d.mu.Lock()
+	p := d.getPolicy()
+	p.deny = nameSet(names)
+	d.policy.Store(p)
+	d.mu.Unlock()
+}
+
+func nameSet(names []string) map[string]bool {
+	if len(names) == 0 {
+		return nil
+	}
+	m := make(map[string]bool, len(names))
+	for _, n := range names {
+		m[n] = true
+	}
+	return m
+}
+
+func (d *Decoder) getPolicy() formatPolicy {
+	p, _ := d.policy.Load().(formatPolicy)
+	return p
+}
+
+// allowed reports whether d may decode images in the format named name.
+func (d *Decoder) allowed(name string) bool {
+	p := d.getPolicy()
+	return !p.deny[name] && (p.allow == nil || p.allow[name])
+}
+
+// SetPeekLimit sets the number of bytes that d peeks at to detect the
+// format of a stream. See the SetPeekLimit function.
+func (d *Decoder) SetPeekLimit(n int) int {
+	if n < 1 {
+		n = DefaultPeekLimit
+	}
+	old := int(atomic.SwapInt64(&d.peekLimit, int64(n)))
+	if old == 0 {
+		old = DefaultPeekLimit
+	}
+	return old
+}
+
+func (d *Decoder) limit() int {
+	if n := atomic.LoadInt64(&d.peekLimit); n > 0 {
+		return int(n)
+	}
+	return DefaultPeekLimit
+}
+
+// SetPeekLimit sets the number of bytes that format detection peeks at from
+// the start of a stream, and returns the previous limit. Magics that extend
+// beyond it never match. A limit below 1 resets it to DefaultPeekLimit.
+func SetPeekLimit(n int) int {
+	return defaultDecoder.SetPeekLimit(n)
+}
+
 // RegisterFormat registers an image format for use by Decode.
 // Name is the name of the format, like "jpeg" or "png".
 // Magic is the magic prefix that identifies the format's encoding. The magic
@@ -48,10 +333,80 @@ var (
 // Decode is the function that decodes the encoded image.
 // DecodeSize is the function that decodes just its configuration.
 func RegisterFormat(name, magic string, decodeSize func(io.Reader) (Size, error)) {
-	formatsMu.Lock()
-	formats, _ := atomicFormats.Load().([]format)
-	atomicFormats.Store(append(formats, format{name, magic, decodeSize}))
-	formatsMu.Unlock()
+	Register(Format{Name: name, Magics: []Magic{{0, magic}}, DecodeSize: decodeSize})
+}
+
+// RegisterFormatFunc registers an image format that has no magic prefix,
+// such as TGA. Validate is given the bytes peeked from the start of the
+// stream and reports whether they are a plausible header of the format.
+// Such formats are only chosen when no format identified by a magic
+// matches.
+func RegisterFormatFunc(name string, validate func([]byte) bool, decodeSize func(io.Reader) (Size, error)) {
+	defaultDecoder.RegisterFormatFunc(name, validate, decodeSize)
+}
+
+// Register registers an image format, recognized by either a list of magics
+// or a sniff function. When several formats match a stream, the one with the
+// highest confidence wins, and the one registered first among equals.
+func Register(f Format) {
+	defaultDecoder.Register(f)
+}
+
+// registerInfo registers a built-in format whose decoder fills in an Info.
+func registerInfo(name, magic string, decodeInfo func(io.Reader) (Info, error)) {
+	registerMagics(name, []Magic{{0, magic}}, decodeInfo)
+}
+
+// registerMagics registers a format recognized by magics, some of which
+// may not be at the start of the stream.
+func registerMagics(name string, magics []Magic, decodeInfo func(io.Reader) (Info, error)) {
+	addFormat(magicFormat(name, magics, decodeInfo))
+}
+
+// magicFormat returns a format recognized by magics, with the confidence
+// that they give.
+func magicFormat(name string, magics []Magic, decodeInfo func(io.Reader) (Info, error)) format {
+	c := 1
+	for _, m := range magics {
+		c += len(m.Pattern) - strings.Count(m.Pattern, "?")
+	}
+	return format{name: name, magics: magics, confidence: c, decodeInfo: decodeInfo}
+}
+
+// registerSniffer registers a format that is recognized by sniff
+// rather than by a magic prefix.
+func registerSniffer(name string, sniff func([]byte) bool, decodeInfo func(io.Reader) (Info, error)) {
+	addFormat(format{name: name, sniff: confidence(sniff, sniffConfidence), decodeInfo: decodeInfo})
+}
+
+// registerFallback registers a built-in format that has no signature, like
+// RegisterFormatFunc does.
+func registerFallback(name string, validate func([]byte) bool, decodeInfo func(io.Reader) (Info, error)) {
+	addFormat(format{name: name, sniff: confidence(validate, fallbackConfidence), decodeInfo: decodeInfo})
+}
+
+// confidence adapts a sniff function that reports a match to one that
+// returns a confidence of c.
+func confidence(sniff func([]byte) bool, c int) func([]byte) int {
+	return func(b []byte) int {
+		if sniff(b) {
+			return c
+		}
+		return 0
+	}
+}
+
+// sizeInfo adapts a decoder that only knows the size of an image.
+func sizeInfo(decodeSize func(io.Reader) (Size, error)) func(io.Reader) (Info, error) {
+	return func(r io.Reader) (Info, error) {
+		size, err := decodeSize(r)
+		return Info{Size: size}, err
+	}
+}
+
+// addFormat registers a format with the default Decoder.
+func addFormat(f format) {
+	defaultDecoder.add(f)
 }
 
 // A reader is an io.Reader that can also peek ahead.
@@ -60,11 +415,20 @@ type reader interface {
 	Peek(int) ([]byte, error)
 }
 
-// asReader converts an io.Reader to a reader.
+// asReader converts an io.Reader to a reader, for the default Decoder.
 func asReader(r io.Reader) reader {
+	return defaultDecoder.asReader(r)
+}
+
+// asReader converts an io.Reader to a reader whose buffer can hold the peek
+// limit of d.
+func (d *Decoder) asReader(r io.Reader) reader {
 	if rr, ok := r.(reader); ok {
 		return rr
 	}
+	if n := d.limit(); n > 4096 {
+		return bufio.NewReaderSize(r, n)
+	}
 	return bufio.NewReader(r)
 }
 
@@ -81,16 +445,55 @@ func match(magic string, b []byte) bool {
 	return true
 }
 
-// Sniff determines the format of r's data.
-func sniff(r reader) format {
-	formats, _ := atomicFormats.Load().([]format)
-	for _, f := range formats {
-		b, err := r.Peek(len(f.magic))
-		if err == nil && match(f.magic, b) {
-			return f
+// match returns the confidence with which f recognizes b, the bytes peeked
+// from the start of a stream, or 0 if it does not.
+func (f *format) match(b []byte) int {
+	if f.sniff != nil {
+		return f.sniff(b)
+	}
+	if len(f.magics) == 0 {
+		return 0
+	}
+	for _, m := range f.magics {
+		end := m.Offset + len(m.Pattern)
+		if m.Offset < 0 || end > len(b) || !match(m.Pattern, b[m.Offset:end]) {
+			return 0
 		}
 	}
-	return format{}
+	return f.confidence
+}
+
+// sniff determines the format of r's data, choosing the most confident
+// match.
+func (d *Decoder) sniff(r reader) format {
+	formats := d.list()
+	// A short stream still gets a chance to match.
+	b, _ := r.Peek(d.limit())
+	var (
+		best format
+		max  int
+	)
+	for i := range formats {
+		if c := formats[i].match(b); c > max {
+			best, max = formats[i], c
+		}
+	}
+	return best
+}
+
+// detect determines the format of r's data among those of d, and returns it
+// with a reader of the data. It fails with ErrFormat if the format is not
+// registered, and with a DisallowedFormatError if d does not allow it.
+func (d *Decoder) detect(r io.Reader) (reader, format, error) {
+	rr := d.asReader(r)
+	f := d.sniff(rr)
+	if f.decodeInfo == nil {
+		return nil, format{}, ErrFormat
+	}
+	if !d.allowed(f.name) {
+		return nil, f, DisallowedFormatError(f.name)
+	}
+	return rr, f, nil
 }
 
 // DecodeSize decodes the dimensions of an image that has
@@ -98,11 +501,33 @@ func sniff(r reader) format {
 // used during format registration. Format registration is typically done by
 // an init function in the codec-specific package.
 func DecodeSize(r io.Reader) (Size, string, error) {
-	rr := asReader(r)
-	f := sniff(rr)
-	if f.decodeSize == nil {
-		return Size{}, "", ErrFormat
+	return defaultDecoder.DecodeSize(r)
+}
+
+// DecodeInfo is like DecodeSize, but also returns the other properties that
+// can be read from the image header, such as its bit depth and color model.
+func DecodeInfo(r io.Reader) (Info, string, error) {
+	return defaultDecoder.DecodeInfo(r)
+}
+
+// DecodeSize is like the DecodeSize function, for the formats of d.
+func (d *Decoder) DecodeSize(r io.Reader) (Size, string, error) {
+	info, name, err := d.DecodeInfo(r)
+	return info.Size, name, err
+}
+
+// DecodeInfo is like the DecodeInfo function, for the formats of d.
+func (d *Decoder) DecodeInfo(r io.Reader) (Info, string, error) {
+	rr, f, err := d.detect(r)
+	if err != nil {
+		return Info{}, f.name, err
+	}
+	info, err := f.decodeInfo(rr)
+	if info.Stored == (Size{}) {
+		info.Stored = info.Size
+	}
+	if info.Display == (Size{}) {
+		info.Display = info.Stored.orient(info.Orientation)
 	}
-	c, err := f.decodeSize(rr)
-	return c, f.name, err
+	return info, f.name, err
 }
@@ -1,8 +1,16 @@
 package imgsz
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
 	"os"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestSizes(t *testing.T) {
@@ -84,3 +92,1169 @@ func TestSizes(t *testing.T) {
 	}
 	f.Close()
 }
+
+// box returns an ISOBMFF box of type typ holding the concatenated payload.
+func box(typ string, payload ...[]byte) []byte {
+	var b []byte
+	for _, p := range payload {
+		b = append(b, p...)
+	}
+	n := uint32(8 + len(b))
+	return append([]byte{byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n), typ[0], typ[1], typ[2], typ[3]}, b...)
+}
+
+func TestHEIF(t *testing.T) {
+	ftyp := func(brands string) []byte { return box("ftyp", []byte(brands)) }
+	ispe := box("ispe", []byte{0, 0, 0, 0, 0, 0, 0x0f, 0xc0, 0, 0, 0x0b, 0xd0}) // 4032x3024
+	irot := box("irot", []byte{1})
+	clap := box("clap", []byte{
+		0, 0, 0x0f, 0xa0, 0, 0, 0, 1, // 4000/1
+		0, 0, 0x0b, 0xb8, 0, 0, 0, 1, // 3000/1
+		0, 0, 0, 0, 0, 0, 0, 1,
+		0, 0, 0, 0, 0, 0, 0, 1,
+	})
+	meta := func(assoc ...byte) []byte {
+		return box("meta", []byte{0, 0, 0, 0},
+			box("hdlr", make([]byte, 24)),
+			box("pitm", []byte{0, 0, 0, 0, 0, 1}),
+			box("iprp",
+				box("ipco", ispe, irot, clap),
+				box("ipma", []byte{0, 0, 0, 0, 0, 0, 0, 1, 0, 1, byte(len(assoc))}, assoc),
+			),
+		)
+	}
+	for _, tc := range []struct {
+		data []byte
+		name string
+		size Size
+	}{
+		{append(ftyp("avif\x00\x00\x00\x00mif1miaf"), meta(0x81)...), "avif", Size{4032, 3024}},
+		{append(ftyp("mif1\x00\x00\x00\x00mif1heic"), meta(0x81, 0x82)...), "heif", Size{3024, 4032}},
+		{append(ftyp("heic\x00\x00\x00\x00mif1heic"), meta(0x81, 0x83, 0x82)...), "heif", Size{3000, 4000}},
+	} {
+		sz, n, err := DecodeSize(bytes.NewReader(tc.data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sz != tc.size || n != tc.name {
+			t.Fatal(sz, n)
+		}
+	}
+}
+
+func TestJXL(t *testing.T) {
+	bare := []byte{0xff, 0x0a, 0xff, 0x01}                 // 256 high, 2:1 ratio
+	explicit := []byte{0xff, 0x0a, 0x18, 0x83, 0x0e, 0x27} // 5000x100
+	container := append([]byte("\x00\x00\x00\x0cJXL \x0d\x0a\x87\x0a"), box("ftyp", []byte("jxl \x00\x00\x00\x00jxl "))...)
+	container = append(container, box("jxlp", []byte{0, 0, 0, 0}, explicit)...)
+	for _, tc := range []struct {
+		data []byte
+		size Size
+	}{
+		{bare, Size{512, 256}},
+		{explicit, Size{5000, 100}},
+		{container, Size{5000, 100}},
+	} {
+		sz, n, err := DecodeSize(bytes.NewReader(tc.data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sz != tc.size || n != "jxl" {
+			t.Fatal(sz, n)
+		}
+	}
+}
+
+func TestInfo(t *testing.T) {
+	for _, tc := range []struct {
+		file string
+		info Info
+	}{
+		{"test.webp", Info{Size: Size{3507, 2480}, BitDepth: 8, ColorModel: ColorYCbCr, Frames: 1}},
+		{"test.jpg", Info{Size: Size{858, 1126}, BitDepth: 8, ColorModel: ColorYCbCr, Interlaced: true, Frames: 1}},
+		{"test.png", Info{Size: Size{670, 717}, BitDepth: 8, Channels: 3, ColorModel: ColorRGB, Frames: 1}},
+		{"test.gif", Info{Size: Size{184, 166}, BitDepth: 7, ColorModel: ColorPalette}},
+		{"test.bmp", Info{Size: Size{677, 487}, BitDepth: 8, ColorModel: ColorRGB, Frames: 1}},
+		{"test.tiff", Info{Size: Size{1032, 1457}, BitDepth: 8, Channels: 4, SampleFormat: SampleUint, ColorModel: ColorRGB, HasAlpha: true, Orientation: 1}},
+	} {
+		f, err := os.Open("testdata/" + tc.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, _, err := DecodeInfo(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(tc.file, err)
+		}
+		tc.info.Stored, tc.info.Display = tc.info.Size, tc.info.Size
+		if info != tc.info {
+			t.Fatalf("%s: got %+v, want %+v", tc.file, info, tc.info)
+		}
+	}
+}
+
+func TestOrientation(t *testing.T) {
+	// A little-endian TIFF header followed by an IFD holding Orientation 6.
+	exif := []byte("Exif\x00\x00II\x2a\x00\x08\x00\x00\x00" +
+		"\x01\x00\x12\x01\x03\x00\x01\x00\x00\x00\x06\x00\x00\x00\x00\x00\x00\x00")
+	jpg := []byte{0xff, 0xd8, 0xff, 0xe1, 0, byte(2 + len(exif))}
+	jpg = append(jpg, exif...)
+	// A baseline SOF for a 640x480 grayscale image.
+	jpg = append(jpg, 0xff, 0xc0, 0, 11, 8, 0x01, 0xe0, 0x02, 0x80, 1, 1, 0x11, 0)
+	info, _, err := DecodeInfo(bytes.NewReader(jpg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Orientation != 6 || info.Stored != (Size{640, 480}) || info.Display != (Size{480, 640}) {
+		t.Fatalf("%+v", info)
+	}
+
+	heif := append(box("ftyp", []byte("heic\x00\x00\x00\x00mif1heic")), box("meta", []byte{0, 0, 0, 0},
+		box("pitm", []byte{0, 0, 0, 0, 0, 1}),
+		box("iprp",
+			box("ipco",
+				box("ispe", []byte{0, 0, 0, 0, 0, 0, 0x0f, 0xc0, 0, 0, 0x0b, 0xd0}),
+				box("irot", []byte{3}),
+				box("imir", []byte{0}),
+			),
+			box("ipma", []byte{0, 0, 0, 0, 0, 0, 0, 1, 0, 1, 3, 0x81, 0x82, 0x83}),
+		),
+	)...)
+	info, _, err = DecodeInfo(bytes.NewReader(heif))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Orientation != 5 || info.Stored != (Size{4032, 3024}) || info.Display != (Size{3024, 4032}) || info.Size != info.Display {
+		t.Fatalf("%+v", info)
+	}
+
+	// The EXIF chunk of a WebP image follows its image data. That of an
+	// animation follows all of its frames, which are not read through.
+	chunk := func(typ string, data []byte) []byte {
+		b := append([]byte(typ), byte(len(data)), byte(len(data)>>8), byte(len(data)>>16), byte(len(data)>>24))
+		return append(b, data...)
+	}
+	webp := func(flags byte, chunks ...[]byte) []byte {
+		b := append([]byte("WEBP"), chunk("VP8X", []byte{flags, 0, 0, 0, 99, 0, 0, 49, 0, 0})...)
+		for _, c := range chunks {
+			b = append(b, c...)
+		}
+		return chunk("RIFF", b)
+	}
+	still := webp(1<<3, chunk("VP8L", make([]byte, 20)), chunk("EXIF", exif[6:]))
+	info, _, err = DecodeInfo(bytes.NewReader(still))
+	if err != nil || info.Orientation != 6 || info.Display != (Size{50, 100}) {
+		t.Fatalf("%+v %v", info, err)
+	}
+	frame := chunk("ANMF", make([]byte, 1<<16))
+	anim := webp(1<<3|1<<1, chunk("ANIM", make([]byte, 6)), frame, frame, chunk("EXIF", exif[6:]))
+	r := bytes.NewReader(anim)
+	info, _, err = DecodeInfo(struct{ io.Reader }{r})
+	if err != nil || info.Orientation != 0 || r.Len() < len(frame) {
+		t.Fatalf("%+v %v, %d bytes left", info, err, r.Len())
+	}
+}
+
+func TestTIFFPages(t *testing.T) {
+	page := func(base, next, subfile, w, h uint32) []byte {
+		return testIFD(base, next, long(tNewSubfileType, subfile), long(tImageWidth, w), long(tImageLength, h))
+	}
+	n := uint32(len(page(0, 0, 0, 0, 0)))
+	b := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	b = append(b, page(8, 8+n, 0, 1000, 800)...)
+	b = append(b, page(8+n, 0, 1, 250, 200)...)
+	pages, err := DecodeTIFFPages(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []TIFFPage{{Size{1000, 800}, 0, false}, {Size{250, 200}, 1, true}}
+	if len(pages) != 2 || pages[0] != want[0] || pages[1] != want[1] {
+		t.Fatal(pages)
+	}
+
+	// Point the second IFD back at the first.
+	b = append(b[:8+n], page(8+n, 8, 1, 250, 200)...)
+	pages, err = DecodeTIFFPages(bytes.NewReader(b))
+	if err == nil || len(pages) != 2 {
+		t.Fatal(pages, err)
+	}
+}
+
+func TestTIFFSampleFormat(t *testing.T) {
+	// A single-channel elevation raster of 32-bit floats.
+	b := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	b = append(b, testIFD(8, 0,
+		long(tImageWidth, 3601),
+		long(tImageLength, 3601),
+		testEntry{tBitsPerSample, dtShort, 1, []byte{0, 32}},
+		testEntry{tPhotometricInterpretation, dtShort, 1, []byte{0, pBlackIsZero}},
+		testEntry{tSamplesPerPixel, dtShort, 1, []byte{0, 1}},
+		testEntry{tSampleFormat, dtShort, 1, []byte{0, sfFloat}},
+	)...)
+	info, _, err := DecodeInfo(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size != (Size{3601, 3601}) || info.BitDepth != 32 || info.Channels != 1 || info.SampleFormat != SampleFloat {
+		t.Fatalf("%+v", info)
+	}
+}
+
+func TestBigTIFF(t *testing.T) {
+	le64 := func(b []byte, v uint64) []byte {
+		for i := 0; i < 8; i++ {
+			b = append(b, byte(v>>(8*i)))
+		}
+		return b
+	}
+	entry := func(b []byte, tag, typ uint16, count, value uint64) []byte {
+		b = append(b, byte(tag), byte(tag>>8), byte(typ), byte(typ>>8))
+		return le64(le64(b, count), value)
+	}
+	b := le64([]byte("II\x2b\x00\x08\x00\x00\x00"), 16)
+	b = le64(b, 3)
+	b = entry(b, tImageWidth, dtLong8, 1, 70000)
+	b = entry(b, tImageLength, dtShort, 1, 500)
+	// The camera model does not fit in the entry, and follows the IFD.
+	b = entry(b, tModel, dtASCII, 13, 16+8+3*20+8)
+	b = le64(b, 0)
+	b = append(b, "Hasselblad X\x00"...)
+
+	info, name, err := DecodeInfo(bytes.NewReader(b))
+	if err != nil || name != "tiff" || info.Size != (Size{70000, 500}) {
+		t.Fatal(info, name, err)
+	}
+	x, _, err := DecodeExif(bytes.NewReader(b))
+	if err != nil || x.Model() != "Hasselblad X" {
+		t.Fatal(x, err)
+	}
+	if v, ok := x.IFD0[tImageWidth].Int(0); !ok || v != 70000 {
+		t.Fatal(v, ok)
+	}
+
+	// Bogus offsets must fail, rather than be buffered up to from a reader
+	// that is not an io.ReaderAt.
+	for _, b := range []string{
+		"II\x2b\x00\x08\x00\x00\x00\xf0\xff\xff\xff\xff\xff\xff\x7f",
+		"II\x2b\x00\x08\x00\x00\x00\x00\x00\x00\x00\x00\x01\x00\x00",
+	} {
+		if _, _, err := DecodeSize(struct{ io.Reader }{strings.NewReader(b)}); err == nil {
+			t.Errorf("%q: no error", b)
+		}
+	}
+	b = le64(b[:len(b)-len("Hasselblad X\x00")-8], 1<<40)
+	pages, err := DecodeTIFFPages(struct{ io.Reader }{bytes.NewReader(b)})
+	if err == nil || len(pages) != 1 {
+		t.Fatal(pages, err)
+	}
+}
+
+func TestRAW(t *testing.T) {
+	// A DNG with a thumbnail in IFD0, and a JPEG preview and the sensor
+	// data in SubIFDs.
+	jpeg := []byte("\xff\xd8\xff\xc0\x00\x11\x08\x02\xab\x04\x00\x03\x01\x22\x00\x02\x11\x01\x03\x11\x01\xff\xd9")
+	ifd0 := func(base, sub0, sub1 uint32) []byte {
+		return testIFD(base, 0,
+			long(tNewSubfileType, 1),
+			long(tImageWidth, 256),
+			long(tImageLength, 171),
+			testEntry{tOrientation, dtShort, 1, []byte{0, 6}},
+			testEntry{tSubIFDs, dtLong, 2, be32(be32(nil, sub0), sub1)},
+			testEntry{tDNGVersion, dtByte, 4, []byte{1, 4, 0, 0}},
+		)
+	}
+	preview := func(base, jpegOff uint32) []byte {
+		return testIFD(base, 0,
+			long(tNewSubfileType, 1),
+			testEntry{tCompression, dtShort, 1, []byte{0, cJPEG}},
+			long(tJPEGInterchangeFormat, jpegOff),
+			long(tJPEGInterchangeFormatLength, uint32(len(jpeg))),
+		)
+	}
+	sensor := func(base uint32) []byte {
+		return testIFD(base, 0,
+			long(tNewSubfileType, 0),
+			long(tImageWidth, 6080),
+			long(tImageLength, 4044),
+			testEntry{tPhotometricInterpretation, dtShort, 1, []byte{0x80, 0x23}},
+			testEntry{tDefaultCropSize, dtLong, 2, be32(be32(nil, 6000), 4000)},
+		)
+	}
+	n0 := uint32(len(ifd0(0, 0, 0)))
+	n1 := uint32(len(preview(0, 0)))
+	sub0, sub1 := 8+n0, 8+n0+n1
+	b := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	b = append(b, ifd0(8, sub0, sub1)...)
+	b = append(b, preview(sub0, sub1+uint32(len(sensor(0))))...)
+	b = append(b, sensor(sub1)...)
+	b = append(b, jpeg...)
+
+	raw, name, err := DecodeRAW(bytes.NewReader(b))
+	if err != nil || name != "tiff" {
+		t.Fatal(name, err)
+	}
+	if raw.Raw != (Size{6000, 4000}) || raw.Orientation != 6 || len(raw.Previews) != 2 ||
+		raw.Previews[0] != (Size{256, 171}) || raw.Previews[1] != (Size{1024, 683}) {
+		t.Fatalf("%+v", raw)
+	}
+	// DecodeInfo reports the full-resolution image rather than the thumbnail,
+	// cropped as DecodeRAW does.
+	info, _, err := DecodeInfo(bytes.NewReader(b))
+	if err != nil || info.Size != (Size{6000, 4000}) || info.Display != (Size{4000, 6000}) {
+		t.Fatalf("%+v %v", info, err)
+	}
+
+	// A CR3 with a thumbnail, a JPEG track and two raw tracks.
+	track := func(w, h uint16, codec string) []byte {
+		entry := make([]byte, 82)
+		entry[24], entry[25], entry[26], entry[27] = byte(w>>8), byte(w), byte(h>>8), byte(h)
+		stsd := box("stsd", make([]byte, 8), box("CRAW", entry, box(codec)))
+		return box("trak", box("mdia", box("minf", box("stbl", stsd))))
+	}
+	cmt1 := []byte("II\x2a\x00\x08\x00\x00\x00\x01\x00\x12\x01\x03\x00\x01\x00\x00\x00\x08\x00\x00\x00\x00\x00\x00\x00")
+	canon := box("uuid", make([]byte, 16), box("CMT1", cmt1), box("THMB", []byte{0, 0, 0, 0, 0, 160, 0, 120}))
+	cr3 := append(box("ftyp", []byte("crx \x00\x00\x00\x01crx isom")),
+		box("moov", canon, track(6000, 4000, "JPEG"), track(1624, 1080, "CMP1"), track(6888, 4546, "CMP1"))...)
+	raw, name, err = DecodeRAW(bytes.NewReader(cr3))
+	if err != nil || name != "cr3" {
+		t.Fatal(name, err)
+	}
+	want := []Size{{160, 120}, {6000, 4000}, {1624, 1080}}
+	if raw.Raw != (Size{6888, 4546}) || raw.Orientation != 8 || len(raw.Previews) != 3 ||
+		raw.Previews[0] != want[0] || raw.Previews[1] != want[1] || raw.Previews[2] != want[2] {
+		t.Fatalf("%+v", raw)
+	}
+	size, _, err := DecodeSize(bytes.NewReader(cr3))
+	if err != nil || size != (Size{6888, 4546}) {
+		t.Fatal(size, err)
+	}
+}
+
+func TestAnimation(t *testing.T) {
+	f, err := os.Open("testdata/test.gif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	anim, name, err := DecodeAnimation(f)
+	f.Close()
+	want := Animation{Animated: true, Frames: 51, Duration: 5100 * time.Millisecond, LoopCount: 0}
+	if err != nil || name != "gif" || anim != want {
+		t.Fatalf("gif: %+v %v", anim, err)
+	}
+
+	// An APNG whose default image is the first of its two frames.
+	fcTL := func(seq uint32, num, den uint16) []byte {
+		b := be32(nil, seq)
+		b = append(b, make([]byte, 16)...)
+		b = be16(be16(b, num), den)
+		return pngChunk("fcTL", append(b, 0, 0))
+	}
+	png := []byte(pngHeader)
+	png = append(png, pngChunk("IHDR", []byte{0, 0, 0, 1, 0, 0, 0, 1, 8, 0, 0, 0, 0})...)
+	png = append(png, pngChunk("acTL", be32(be32(nil, 2), 3))...)
+	png = append(png, fcTL(0, 1, 10)...)
+	png = append(png, pngChunk("IDAT", []byte{0x78, 0x9c})...)
+	png = append(png, fcTL(1, 50, 0)...)
+	png = append(png, pngChunk("fdAT", []byte{0, 0, 0, 2, 0x78, 0x9c})...)
+	png = append(png, pngChunk("IEND", nil)...)
+	anim, _, err = DecodeAnimation(bytes.NewReader(png))
+	want = Animation{Animated: true, Frames: 2, Duration: 600 * time.Millisecond, LoopCount: 3}
+	if err != nil || anim != want {
+		t.Fatalf("png: %+v %v", anim, err)
+	}
+
+	// An animated WebP that loops forever.
+	chunk := func(id string, data []byte) []byte {
+		n := len(data)
+		b := append([]byte(id), byte(n), byte(n>>8), byte(n>>16), byte(n>>24))
+		return append(b, data...)
+	}
+	anmf := func(ms int) []byte {
+		b := make([]byte, 16)
+		b[12], b[13] = byte(ms), byte(ms>>8)
+		return chunk("ANMF", b)
+	}
+	webp := []byte("WEBP")
+	webp = append(webp, chunk("VP8X", []byte{1 << 1, 0, 0, 0, 99, 0, 0, 99, 0, 0})...)
+	webp = append(webp, chunk("ANIM", make([]byte, 6))...)
+	webp = append(webp, anmf(100)...)
+	webp = append(webp, anmf(250)...)
+	webp = append(chunk("RIFF", nil), webp...)
+	webp[4] = byte(len(webp) - 8)
+	anim, _, err = DecodeAnimation(bytes.NewReader(webp))
+	want = Animation{Animated: true, Frames: 2, Duration: 350 * time.Millisecond, LoopCount: 0}
+	if err != nil || anim != want {
+		t.Fatalf("webp: %+v %v", anim, err)
+	}
+}
+
+func TestIcons(t *testing.T) {
+	le16 := func(b []byte, v uint16) []byte { return append(b, byte(v), byte(v>>8)) }
+	le32 := func(b []byte, v uint32) []byte { return le16(le16(b, uint16(v)), uint16(v>>16)) }
+	// A 16x16 DIB at 32 bits per pixel, whose height counts the AND mask.
+	dib := le32(le32(le32(nil, 40), 16), 32)
+	dib = le16(le16(dib, 1), 32)
+	dib = append(dib, make([]byte, 24+16*16*4+16*4)...)
+	png := []byte(pngHeader)
+	png = append(png, pngChunk("IHDR", []byte{0, 0, 1, 0, 0, 0, 1, 0, 8, 6, 0, 0, 0})...)
+	png = append(png, pngChunk("IEND", nil)...)
+
+	file := func(typ uint16, x, y uint16) []byte {
+		b := le16(le16(le16(nil, 0), typ), 2)
+		off := uint32(6 + 2*16)
+		b = append(b, 16, 16, 0, 0)
+		b = le32(le32(le16(le16(b, x), y), uint32(len(dib))), off)
+		b = append(b, 0, 0, 0, 0)
+		b = le32(le32(le16(le16(b, x), y), uint32(len(png))), off+uint32(len(dib)))
+		return append(append(b, dib...), png...)
+	}
+	ico := file(1, 1, 32)
+	info, name, err := DecodeInfo(bytes.NewReader(ico))
+	if err != nil || name != "ico" || info.Size != (Size{256, 256}) || !info.HasAlpha {
+		t.Fatalf("%s %+v %v", name, info, err)
+	}
+	cur := file(2, 3, 5)
+	entries, name, err := DecodeIcons(bytes.NewReader(cur))
+	if err != nil || name != "cur" || len(entries) != 2 {
+		t.Fatal(name, entries, err)
+	}
+	want := []IconEntry{
+		{Size: Size{16, 16}, BitsPerPixel: 32, Format: "bmp", Scale: 1, Hotspot: image.Point{3, 5}},
+		{Size: Size{256, 256}, BitsPerPixel: 32, Format: "png", Scale: 1, Hotspot: image.Point{3, 5}},
+	}
+	if entries[0] != want[0] || entries[1] != want[1] {
+		t.Fatalf("%+v", entries)
+	}
+
+	// The directory must agree with the image.
+	cur[6] = 32
+	if _, _, err := DecodeIcons(bytes.NewReader(cur)); err == nil {
+		t.Fatal("mismatched directory entry accepted")
+	}
+
+	// Image offsets out of the file or past any real icon file must fail,
+	// without buffering up to them from a reader that is not an
+	// io.ReaderAt.
+	for _, off := range []uint32{0xfffffff0, 6 + 2*16 + uint32(len(dib)) + 16} {
+		b := append([]byte(nil), ico...)
+		le32(b[:6+16+12], off)
+		if _, _, err := DecodeSize(struct{ io.Reader }{bytes.NewReader(b)}); err == nil {
+			t.Errorf("offset %#x: no error", off)
+		}
+	}
+}
+
+func TestICNS(t *testing.T) {
+	chunk := func(typ string, data []byte) []byte {
+		return append(be32([]byte(typ), uint32(8+len(data))), data...)
+	}
+	png := []byte(pngHeader)
+	png = append(png, pngChunk("IHDR", []byte{0, 0, 4, 0, 0, 0, 4, 0, 8, 6, 0, 0, 0})...)
+	jp2 := []byte(jp2Header)
+	jp2 = append(jp2, box("jp2h", box("ihdr", []byte{0, 0, 0, 64, 0, 0, 0, 64, 0, 3, 7, 7, 0, 0}))...)
+	var b []byte
+	b = append(b, chunk("is32", make([]byte, 40))...)
+	b = append(b, chunk("s8mk", make([]byte, 256))...)
+	b = append(b, chunk("ic05", []byte("ARGB\x00\x00"))...)
+	b = append(b, chunk("ic12", jp2)...)
+	b = append(b, chunk("ic10", png)...)
+	b = append(chunk("icns", nil), b...)
+	copy(b[4:8], be32(nil, uint32(len(b))))
+
+	size, name, err := DecodeSize(bytes.NewReader(b))
+	if err != nil || name != "icns" || size != (Size{1024, 1024}) {
+		t.Fatal(name, size, err)
+	}
+	entries, _, err := DecodeIcons(bytes.NewReader(b))
+	want := []IconEntry{
+		{Size: Size{16, 16}, BitsPerPixel: 24, Format: "rgb", Scale: 1},
+		{Size: Size{32, 32}, BitsPerPixel: 32, Format: "argb", Scale: 1},
+		{Size: Size{64, 64}, BitsPerPixel: 24, Format: "jp2", Scale: 2},
+		{Size: Size{1024, 1024}, BitsPerPixel: 32, Format: "png", Scale: 2},
+	}
+	if err != nil || len(entries) != len(want) {
+		t.Fatal(entries, err)
+	}
+	for i := range want {
+		if entries[i] != want[i] {
+			t.Errorf("entry %d: got %+v, want %+v", i, entries[i], want[i])
+		}
+	}
+
+	// A type that must embed PNG or JPEG 2000 data.
+	b = append(chunk("icns", nil), chunk("ic08", make([]byte, 64))...)
+	copy(b[4:8], be32(nil, uint32(len(b))))
+	if _, _, err := DecodeSize(bytes.NewReader(b)); err == nil {
+		t.Fatal("bad ic08 data accepted")
+	}
+}
+
+func TestNetpbm(t *testing.T) {
+	for _, tc := range []struct {
+		header string
+		info   Info
+	}{
+		{"P1\n# a bitmap\n3 2\n", Info{Size: Size{3, 2}, BitDepth: 1, Channels: 1, ColorModel: ColorGray}},
+		{"P5 640#comment\n480\t1023\n", Info{Size: Size{640, 480}, BitDepth: 10, Channels: 1, ColorModel: ColorGray}},
+		{"P6\r\n1920 1080\r\n255\r\n", Info{Size: Size{1920, 1080}, BitDepth: 8, Channels: 3, ColorModel: ColorRGB}},
+		{"PF\n4 4\n-1.0\n", Info{Size: Size{4, 4}, BitDepth: 32, Channels: 3, SampleFormat: SampleFloat, ColorModel: ColorRGB}},
+		{"P7\nWIDTH 227\nHEIGHT 149\nDEPTH 4\nMAXVAL 65535\nTUPLTYPE RGB_ALPHA\nENDHDR\n",
+			Info{Size: Size{227, 149}, BitDepth: 16, Channels: 4, ColorModel: ColorRGB, HasAlpha: true}},
+		{"P7\nTUPLTYPE\nWIDTH 3\nHEIGHT 2\nDEPTH 1\nMAXVAL 255\nTUPLTYPE# none\nENDHDR\n",
+			Info{Size: Size{3, 2}, BitDepth: 8, Channels: 1}},
+	} {
+		info, name, err := DecodeInfo(strings.NewReader(tc.header))
+		if err != nil || name != "netpbm" {
+			t.Fatalf("%q: %s %v", tc.header, name, err)
+		}
+		if tc.info.SampleFormat == SampleUnknown {
+			tc.info.SampleFormat = SampleUint
+		}
+		tc.info.Frames = 1
+		tc.info.Stored, tc.info.Display = tc.info.Size, tc.info.Size
+		if info != tc.info {
+			t.Errorf("%q: got %+v, want %+v", tc.header, info, tc.info)
+		}
+	}
+	if _, _, err := DecodeSize(strings.NewReader("P7\nWIDTH 2\nENDHDR\n")); err == nil {
+		t.Error("incomplete PAM header accepted")
+	}
+}
+
+func TestQOI(t *testing.T) {
+	qoi := be32(be32([]byte(qoiHeader), 800), 600)
+	info, name, err := DecodeInfo(bytes.NewReader(append(qoi, 4, 1)))
+	if err != nil || name != "qoi" || info.Size != (Size{800, 600}) ||
+		info.Channels != 4 || !info.HasAlpha || info.ColorSpace != ColorSpaceLinear {
+		t.Fatalf("%s %+v %v", name, info, err)
+	}
+	for _, bad := range [][]byte{{2, 0}, {3, 2}} {
+		if _, _, err := DecodeInfo(bytes.NewReader(append(qoi, bad...))); err == nil {
+			t.Errorf("header fields %v accepted", bad)
+		}
+	}
+
+	ff := be32(be32([]byte(farbfeldHeader), 31), 17)
+	info, name, err = DecodeInfo(bytes.NewReader(ff))
+	if err != nil || name != "farbfeld" || info.Size != (Size{31, 17}) || info.BitDepth != 16 || info.Channels != 4 {
+		t.Fatalf("%s %+v %v", name, info, err)
+	}
+}
+
+func TestTGA(t *testing.T) {
+	tga := func(cmapType, imageType byte, cmapLen uint16, cmapBits byte, w, h uint16, bpp, desc byte) []byte {
+		b := make([]byte, tgaHeaderLen, tgaHeaderLen+16)
+		b[1], b[2] = cmapType, imageType
+		b[5], b[6], b[7] = byte(cmapLen), byte(cmapLen>>8), cmapBits
+		b[12], b[13], b[14], b[15] = byte(w), byte(w>>8), byte(h), byte(h>>8)
+		b[16], b[17] = bpp, desc
+		return append(b, make([]byte, 16)...)
+	}
+	for _, tc := range []struct {
+		b     []byte
+		depth int
+		model ColorModel
+		alpha bool
+	}{
+		{tga(0, tgaRLETrueColor, 0, 0, 640, 480, 32, 0x28), 8, ColorRGB, true},
+		{tga(0, tgaTrueColor, 0, 0, 640, 480, 16, 0), 5, ColorRGB, false},
+		{tga(1, tgaColorMapped, 256, 24, 640, 480, 8, 0), 8, ColorPalette, false},
+		{tga(0, tgaRLEGray, 0, 0, 640, 480, 8, 0), 8, ColorGray, false},
+	} {
+		info, name, err := DecodeInfo(bytes.NewReader(tc.b))
+		if err != nil || name != "tga" || info.Size != (Size{640, 480}) ||
+			info.BitDepth != tc.depth || info.ColorModel != tc.model || info.HasAlpha != tc.alpha {
+			t.Errorf("%x: %s %+v %v", tc.b[:tgaHeaderLen], name, info, err)
+		}
+	}
+	for _, b := range [][]byte{
+		tga(0, tgaColorMapped, 0, 0, 640, 480, 8, 0),
+		tga(0, tgaTrueColor, 0, 0, 640, 480, 24, 8),
+		tga(2, tgaTrueColor, 0, 0, 640, 480, 24, 0),
+		tga(0, tgaTrueColor, 0, 0, 0, 480, 24, 0),
+		[]byte("not an image at all, though long enough to hold a header"),
+	} {
+		if _, name, err := DecodeInfo(bytes.NewReader(b)); err != ErrFormat {
+			t.Errorf("%x: got %s, %v", b[:tgaHeaderLen], name, err)
+		}
+	}
+
+	// Formats with a validation function come after those with a magic,
+	// whether registered with a Decoder or with the package function.
+	validate := func(b []byte) bool { return len(b) > 0 && b[0] == pngHeader[0] }
+	decodeSize := func(io.Reader) (Size, error) { return Size{1, 1}, nil }
+	d := NewDecoder()
+	d.RegisterFormatFunc("test-fallback", validate, decodeSize)
+	RegisterFormatFunc("test-fallback", validate, decodeSize)
+	png, err := os.ReadFile("testdata/test.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, decode := range []func(io.Reader) (Size, string, error){d.DecodeSize, DecodeSize} {
+		if _, name, err := decode(bytes.NewReader([]byte("\x89fallback"))); err != nil || name != "test-fallback" {
+			t.Errorf("got %s, %v", name, err)
+		}
+		if _, name, err := decode(bytes.NewReader(png)); err != nil || name != "png" {
+			t.Errorf("got %s, %v", name, err)
+		}
+	}
+	if !defaultDecoder.Unregister("test-fallback") {
+		t.Fatal("test-fallback not registered")
+	}
+	if _, _, err := DecodeSize(bytes.NewReader([]byte("\x89fallback"))); err != ErrFormat {
+		t.Errorf("unregistered format: got %v", err)
+	}
+}
+
+func TestTexture(t *testing.T) {
+	le32 := func(b []byte, off int, v uint32) {
+		b[off], b[off+1], b[off+2], b[off+3] = byte(v), byte(v>>8), byte(v>>16), byte(v>>24)
+	}
+
+	dds := make([]byte, ddsHeaderLen+dx10Len)
+	copy(dds, ddsHeader)
+	le32(dds, 4, 124)
+	le32(dds, 8, ddsdMipMapCount)
+	le32(dds, 12, 256)
+	le32(dds, 16, 512)
+	le32(dds, 28, 10)
+	le32(dds, 76, 32)
+	le32(dds, 80, ddpfFourCC)
+	copy(dds[84:], "DX10")
+	le32(dds, 112, ddsCaps2Cubemap|ddsCaps2CubeFaces)
+	le32(dds, 128, 98) // DXGI_FORMAT_BC7_UNORM
+	le32(dds, 132, 3)
+	le32(dds, 136, dx10MiscCube)
+	le32(dds, 140, 2)
+	tex, name, err := DecodeTexture(bytes.NewReader(dds))
+	want := Texture{Size: Size{512, 256}, Depth: 1, MipLevels: 10, Layers: 2, Faces: 6, FourCC: "DX10", DXGIFormat: 98}
+	if err != nil || name != "dds" || tex != want {
+		t.Errorf("%s %+v %v", name, tex, err)
+	}
+
+	ktx := make([]byte, ktxHeaderLen)
+	copy(ktx, ktxHeader)
+	for i, v := range []uint32{ktxEndianness, 0, 1, 0, 0x8e8c, 0x1908, 64, 32, 16, 0, 1, 0} {
+		binary.BigEndian.PutUint32(ktx[12+4*i:], v)
+	}
+	tex, name, err = DecodeTexture(bytes.NewReader(ktx))
+	want = Texture{Size: Size{64, 32}, Depth: 16, MipLevels: 1, Layers: 1, Faces: 1, GLInternalFormat: 0x8e8c}
+	if err != nil || name != "ktx" || tex != want {
+		t.Errorf("%s %+v %v", name, tex, err)
+	}
+
+	ktx2 := make([]byte, ktx2HeaderLen)
+	copy(ktx2, ktx2Header)
+	for i, v := range []uint32{37, 1, 128, 0, 0, 4, 1, 8} {
+		le32(ktx2, 12+4*i, v)
+	}
+	info, name, err := DecodeInfo(bytes.NewReader(ktx2))
+	if err != nil || name != "ktx2" || info.Size != (Size{128, 1}) {
+		t.Errorf("%s %+v %v", name, info, err)
+	}
+	tex, _, err = DecodeTexture(bytes.NewReader(ktx2))
+	want = Texture{Size: Size{128, 1}, Depth: 1, MipLevels: 8, Layers: 4, Faces: 1, VkFormat: 37}
+	if err != nil || tex != want {
+		t.Errorf("%+v %v", tex, err)
+	}
+}
+
+func TestEXR(t *testing.T) {
+	le32 := func(v ...int32) []byte {
+		b := make([]byte, 4*len(v))
+		for i, x := range v {
+			binary.LittleEndian.PutUint32(b[4*i:], uint32(x))
+		}
+		return b
+	}
+	attr := func(name, typ string, v []byte) []byte {
+		b := append([]byte(name+"\x00"+typ+"\x00"), le32(int32(len(v)))...)
+		return append(b, v...)
+	}
+	var chlist []byte
+	for _, ch := range []string{"A", "B", "G", "R"} {
+		chlist = append(chlist, ch+"\x00"...)
+		chlist = append(chlist, le32(exrHalf, 0, 1, 1)...)
+	}
+	chlist = append(chlist, 0)
+	header := func(dataWindow, displayWindow []byte, extra ...[]byte) []byte {
+		b := attr("channels", "chlist", chlist)
+		b = append(b, attr("compression", "compression", []byte{3})...)
+		b = append(b, attr("dataWindow", "box2i", dataWindow)...)
+		b = append(b, attr("displayWindow", "box2i", displayWindow)...)
+		for _, e := range extra {
+			b = append(b, e...)
+		}
+		return append(b, 0)
+	}
+
+	exr := append([]byte(exrHeader), le32(2)...)
+	exr = append(exr, header(le32(10, 20, 109, 69), le32(0, 0, 1919, 1079))...)
+	info, name, err := DecodeInfo(bytes.NewReader(exr))
+	if err != nil || name != "exr" || info.Size != (Size{100, 50}) || info.Display != (Size{1920, 1080}) ||
+		info.Channels != 4 || !info.HasAlpha || info.BitDepth != 16 || info.SampleFormat != SampleFloat {
+		t.Errorf("%s %+v %v", name, info, err)
+	}
+
+	exr = append([]byte(exrHeader), le32(2|exrMultipart)...)
+	exr = append(exr, header(le32(0, 0, 63, 63), le32(0, 0, 63, 63),
+		attr("name", "string", []byte("left")), attr("type", "string", []byte("scanlineimage")))...)
+	exr = append(exr, header(le32(0, 0, 31, 31), le32(0, 0, 63, 63),
+		attr("name", "string", []byte("right")), attr("type", "string", []byte("tiledimage")))...)
+	exr = append(exr, 0)
+	x, err := DecodeEXR(bytes.NewReader(exr))
+	if err != nil || !x.Multipart || len(x.Parts) != 2 {
+		t.Fatalf("%+v %v", x, err)
+	}
+	if p := x.Parts[1]; p.Name != "right" || !p.Tiled || p.DataWindow != image.Rect(0, 0, 32, 32) ||
+		strings.Join(p.Channels, "") != "ABGR" {
+		t.Errorf("%+v", p)
+	}
+}
+
+func TestRadianceHDR(t *testing.T) {
+	for _, tc := range []struct {
+		res         string
+		orientation int
+		display     Size
+	}{
+		{"-Y 480 +X 640", 1, Size{640, 480}},
+		{"+Y 480 -X 640", 3, Size{640, 480}},
+		{"+X 640 -Y 480", 5, Size{640, 480}},
+		{"-X 640 +Y 480", 7, Size{640, 480}},
+	} {
+		hdr := "#?RADIANCE\n# made by hand\nFORMAT=32-bit_rle_rgbe\nEXPOSURE=1.0\n\n" + tc.res + "\n"
+		info, name, err := DecodeInfo(strings.NewReader(hdr))
+		if err != nil || name != "hdr" || info.Orientation != tc.orientation || info.Display != tc.display ||
+			info.ColorModel != ColorRGB || info.SampleFormat != SampleFloat {
+			t.Errorf("%s: %s %+v %v", tc.res, name, info, err)
+		}
+	}
+	if _, _, err := DecodeInfo(strings.NewReader("#?RGBE\n\n-Y 480 +Y 640\n")); err == nil {
+		t.Error("bad axis order accepted")
+	}
+}
+
+func TestJPEG2000(t *testing.T) {
+	// A 1000x600 image at offset (8, 4) of the reference grid, with
+	// 512x512 tiles starting at the origin and three 8-bit components.
+	siz := []byte{0xff, 0x4f, 0xff, 0x51, 0, 47, 0, 0}
+	for _, v := range []uint32{1008, 604, 8, 4, 512, 512, 0, 0} {
+		siz = be32(siz, v)
+	}
+	siz = append(siz, 0, 3, 7, 1, 1, 7, 1, 1, 7, 1, 1)
+	want := JPEG2000Info{
+		Size:       Size{1000, 600},
+		Components: 3,
+		BitDepth:   8,
+		TileSize:   Size{512, 512},
+		Tiles:      Size{2, 2},
+	}
+	info, name, err := DecodeInfo(bytes.NewReader(siz))
+	if err != nil || name != "j2k" || info.Size != want.Size || info.Channels != 3 || info.BitDepth != 8 {
+		t.Errorf("%s %+v %v", name, info, err)
+	}
+	if j, err := DecodeJPEG2000(bytes.NewReader(siz)); err != nil || j != want {
+		t.Errorf("%+v %v", j, err)
+	}
+
+	jp2 := []byte(jp2Header)
+	jp2 = append(jp2, box("ftyp", []byte("jp2 \x00\x00\x00\x00jp2 "))...)
+	jp2 = append(jp2, box("jp2h",
+		box("ihdr", []byte{0, 0, 2, 0x58, 0, 0, 3, 0xe8, 0, 3, 7, 7, 0, 0}),
+		box("colr", []byte{1, 0, 0, 0, 0, 0, 16}))...)
+	jp2 = append(jp2, box("jp2c", siz)...)
+	info, name, err = DecodeInfo(bytes.NewReader(jp2))
+	if err != nil || name != "jp2" || info.Size != want.Size || info.ColorModel != ColorRGB || info.ColorSpace != ColorSpaceSRGB {
+		t.Errorf("%s %+v %v", name, info, err)
+	}
+	if j, err := DecodeJPEG2000(bytes.NewReader(jp2)); err != nil || j != want {
+		t.Errorf("%+v %v", j, err)
+	}
+}
+
+func TestPSD(t *testing.T) {
+	psd := func(magic string, channels uint16, h, w uint32, depth, mode uint16) []byte {
+		b := append([]byte(magic), make([]byte, 6)...)
+		b = be16(b, channels)
+		b = be32(be32(b, h), w)
+		return be16(be16(b, depth), mode)
+	}
+	info, name, err := DecodeInfo(bytes.NewReader(psd(psdHeader, 4, 1080, 1920, 8, psdRGB)))
+	if err != nil || name != "psd" || info.Size != (Size{1920, 1080}) || info.Channels != 4 ||
+		info.BitDepth != 8 || info.ColorModel != ColorRGB || !info.HasAlpha {
+		t.Errorf("%s %+v %v", name, info, err)
+	}
+	info, name, err = DecodeInfo(bytes.NewReader(psd(psbHeader, 4, 100000, 40000, 16, psdCMYK)))
+	if err != nil || name != "psb" || info.Size != (Size{40000, 100000}) || info.ColorModel != ColorCMYK || info.HasAlpha {
+		t.Errorf("%s %+v %v", name, info, err)
+	}
+	if _, _, err := DecodeInfo(bytes.NewReader(psd(psdHeader, 3, 100000, 40000, 8, psdRGB))); err == nil {
+		t.Error("PSD larger than 30000 pixels accepted")
+	}
+}
+
+func TestSVG(t *testing.T) {
+	const prolog = `<?xml version="1.0" encoding="ISO-8859-1"?>
+<!-- A comment that, like the declarations around it, comes before the root. -->
+<!DOCTYPE svg PUBLIC "-//W3C//DTD SVG 1.1//EN" "http://www.w3.org/Graphics/SVG/1.1/DTD/svg11.dtd">
+`
+	for _, tc := range []struct {
+		svg    string
+		size   Size
+		source SVGSizeSource
+	}{
+		{`<svg xmlns="http://www.w3.org/2000/svg" width="120" height="80px"/>`, Size{120, 80}, SVGSizeExplicit},
+		{prolog + `<svg xmlns="http://www.w3.org/2000/svg" width="1in" height="72pt">`, Size{96, 96}, SVGSizeExplicit},
+		{`<svg width="25.4mm" viewBox="0 0 200 100">`, Size{96, 48}, SVGSizeExplicit},
+		{`<svg width="2em" height="1e1ex">`, Size{32, 80}, SVGSizeExplicit},
+		{`<svg width="100%" height="100%" viewBox="0,0,24,16">`, Size{24, 16}, SVGSizeViewBox},
+		{`<svg width="100%">`, Size{}, SVGSizeUnknown},
+	} {
+		svg, err := DecodeSVG(strings.NewReader(tc.svg))
+		if err != nil || svg.Size != tc.size || svg.Source != tc.source {
+			t.Errorf("%s: %+v %v", tc.svg, svg, err)
+		}
+		size, name, err := DecodeSize(strings.NewReader(tc.svg))
+		if tc.source != SVGSizeUnknown && (err != nil || name != "svg" || size != tc.size) {
+			t.Errorf("%s: %s %v %v", tc.svg, name, size, err)
+		}
+	}
+
+	var z bytes.Buffer
+	zw := gzip.NewWriter(&z)
+	zw.Write([]byte(prolog + `<svg viewBox="0 0 48 48"></svg>`))
+	zw.Close()
+	size, name, err := DecodeSize(bytes.NewReader(z.Bytes()))
+	if err != nil || name != "svgz" || size != (Size{48, 48}) {
+		t.Errorf("%s %v %v", name, size, err)
+	}
+	for _, b := range []string{
+		`<?xml version="1.0"?><html/>`,
+		`<!DOCTYPE html [<!ENTITY svg "<svg>">]><html/>`,
+		`<rss version="2.0"><channel><svg/></channel></rss>`,
+	} {
+		if _, _, err := DecodeSize(strings.NewReader(b)); err != ErrFormat {
+			t.Errorf("%s: %v", b, err)
+		}
+	}
+	z.Reset()
+	zw.Reset(&z)
+	zw.Write([]byte("2024-01-01 log line\n"))
+	zw.Close()
+	if _, _, err := DecodeSize(bytes.NewReader(z.Bytes())); err != ErrFormat {
+		t.Errorf("gzip stream that is not SVG: %v", err)
+	}
+}
+
+func TestLegacyRaster(t *testing.T) {
+	pcx := make([]byte, pcxHeaderLen)
+	copy(pcx, []byte{0x0a, 5, 1, 8, 10, 0, 20, 0, 0x3b, 1, 0x0f, 1})
+	pcx[65] = 3
+
+	ras := be32([]byte(sunRasterHeader), 320)
+	for _, v := range []uint32{200, 8, 0, 1, 1, 768} {
+		ras = be32(ras, v)
+	}
+
+	sgi := be16(be16(be16(be16([]byte{0x01, 0xda, 1, 2}, 3), 64), 32), 4)
+
+	xpm := xpmHeader + `
+static char * icon_xpm[] = {
+/* columns rows colors chars-per-pixel */
+"16 12 3 1 0 0",
+"  c None",
+". c #000000",
+"+ c #FFFFFF",
+`
+	for _, tc := range []struct {
+		name  string
+		b     []byte
+		size  Size
+		depth int
+		model ColorModel
+		alpha bool
+	}{
+		{"pcx", pcx, Size{306, 252}, 8, ColorRGB, false},
+		{"ras", ras, Size{320, 200}, 8, ColorPalette, false},
+		{"sgi", sgi, Size{64, 32}, 16, ColorRGB, true},
+		{"wbmp", []byte{0, 0, 0x81, 0x20, 0x60, 0xff}, Size{160, 96}, 1, ColorGray, false},
+		{"xbm", []byte("#define test_width 0x10\n#define test_height 7\nstatic char test_bits[] = {"), Size{16, 7}, 1, ColorGray, false},
+		{"xpm", []byte(xpm), Size{16, 12}, 2, ColorPalette, true},
+		{"xpm", []byte("! XPM2\n16 12 2 1\n. c #000000\n# c #ffffff\n"), Size{16, 12}, 1, ColorPalette, false},
+	} {
+		info, name, err := DecodeInfo(bytes.NewReader(tc.b))
+		if err != nil || name != tc.name || info.Size != tc.size || info.BitDepth != tc.depth ||
+			info.ColorModel != tc.model || info.HasAlpha != tc.alpha {
+			t.Errorf("%s: %s %+v %v", tc.name, name, info, err)
+		}
+	}
+
+	// Binary data that merely starts with two zero bytes is not WBMP, nor
+	// are C sources that start with other macros than XBM dimensions.
+	for _, b := range []string{
+		"\x00\x00\x05\x05" + strings.Repeat("\xaa", 64),
+		"\x00\x00\xff\xff\x7f\x10\x00",
+		"#define VERSION 3\n#define test_width 16\n#define test_height 7\n",
+	} {
+		if _, _, err := DecodeSize(strings.NewReader(b)); err != ErrFormat {
+			t.Errorf("%q: %v", b, err)
+		}
+	}
+}
+
+func TestDICOM(t *testing.T) {
+	// An elemFunc encodes a data element, with an undefined length if v is
+	// nil.
+	type elemFunc func(group, element uint16, vr string, v []byte) []byte
+	encoder := func(order binary.ByteOrder, explicit bool) elemFunc {
+		return func(group, element uint16, vr string, v []byte) []byte {
+			b := make([]byte, 4, 12+len(v))
+			order.PutUint16(b[0:], group)
+			order.PutUint16(b[2:], element)
+			n := uint32(len(v))
+			if v == nil {
+				n = dicomUndefinedLength
+			}
+			switch {
+			case !explicit || group == 0xfffe:
+				b = append(b, 0, 0, 0, 0)
+				order.PutUint32(b[4:], n)
+			case dicomLongVR(vr):
+				b = append(b, vr[0], vr[1], 0, 0, 0, 0, 0, 0)
+				order.PutUint32(b[8:], n)
+			default:
+				b = append(b, vr[0], vr[1], 0, 0)
+				order.PutUint16(b[6:], uint16(n))
+			}
+			return append(b, v...)
+		}
+	}
+	us := func(order binary.ByteOrder, v uint16) []byte {
+		b := make([]byte, 2)
+		order.PutUint16(b, v)
+		return b
+	}
+	meta := encoder(binary.LittleEndian, true)
+	for _, tc := range []struct {
+		ts       string
+		order    binary.ByteOrder
+		explicit bool
+	}{
+		{"1.2.840.10008.1.2.1\x00", binary.LittleEndian, true},
+		{tsImplicitLE + "\x00", binary.LittleEndian, false},
+		{tsExplicitBE + "\x00", binary.BigEndian, true},
+	} {
+		b := append(make([]byte, dicomPreambleLen), dicomPrefix...)
+		b = append(b, meta(0x0002, 0x0001, "OB", []byte{0, 1})...)
+		b = append(b, meta(0x0002, 0x0010, "UI", []byte(tc.ts))...)
+		e := encoder(tc.order, tc.explicit)
+		// A sequence of undefined length, whose item holds a Rows element
+		// that is not the image's.
+		b = append(b, e(0x0008, 0x1140, "SQ", nil)...)
+		b = append(b, e(0xfffe, 0xe000, "", nil)...)
+		b = append(b, e(0x0028, 0x0010, "US", us(tc.order, 7))...)
+		b = append(b, e(0xfffe, 0xe00d, "", []byte{})...)
+		b = append(b, e(0xfffe, 0xe0dd, "", []byte{})...)
+		b = append(b, e(0x0028, 0x0002, "US", us(tc.order, 1))...)
+		b = append(b, e(0x0028, 0x0004, "CS", []byte("MONOCHROME2 "))...)
+		b = append(b, e(0x0028, 0x0008, "IS", []byte("12"))...)
+		b = append(b, e(0x0028, 0x0010, "US", us(tc.order, 512))...)
+		b = append(b, e(0x0028, 0x0011, "US", us(tc.order, 256))...)
+		b = append(b, e(0x0028, 0x0100, "US", us(tc.order, 16))...)
+		b = append(b, e(0x0028, 0x0101, "US", us(tc.order, 12))...)
+		b = append(b, e(0x7fe0, 0x0010, "OW", nil)...)
+		info, name, err := DecodeInfo(bytes.NewReader(b))
+		if err != nil || name != "dicom" || info.Size != (Size{256, 512}) || info.Frames != 12 ||
+			info.BitDepth != 12 || info.ColorModel != ColorGray {
+			t.Errorf("%q: %s %+v %v", tc.ts, name, info, err)
+		}
+	}
+}
+
+func TestFITS(t *testing.T) {
+	var b []byte
+	for _, c := range []string{
+		"SIMPLE  =                    T / conforms to FITS standard",
+		"BITPIX  =                   16",
+		"NAXIS   =                    3",
+		"NAXIS1  =                 2048",
+		"NAXIS2  =                 1024",
+		"NAXIS3  =                    3",
+		"BZERO   =              32768.0",
+		"OBJECT  = 'M31 / Andromeda'",
+		"END",
+	} {
+		b = append(b, fmt.Sprintf("%-80s", c)...)
+	}
+	info, name, err := DecodeInfo(bytes.NewReader(b))
+	if err != nil || name != "fits" || info.Size != (Size{2048, 1024}) || info.Frames != 3 ||
+		info.BitDepth != 16 || info.SampleFormat != SampleUint {
+		t.Errorf("%s %+v %v", name, info, err)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	size := func(io.Reader) (Size, error) { return Size{1, 1}, nil }
+	d := NewDecoder()
+	d.Register(Format{Name: "test-offset", Magics: []Magic{{0, "RIFF"}, {8, "TEST"}}, DecodeSize: size})
+	d.Register(Format{
+		Name: "test-confidence",
+		Sniff: func(b []byte) int {
+			if bytes.HasPrefix(b, []byte("GIF89a\xff\xfe")) {
+				return 100
+			}
+			return 0
+		},
+		DecodeSize: size,
+	})
+	d.Register(Format{Name: "test-far", Magics: []Magic{{1000, "FAR"}}, DecodeSize: size})
+
+	far := append(make([]byte, 1000), "FAR"...)
+	for _, tc := range []struct {
+		b    []byte
+		name string
+	}{
+		{[]byte("RIFF\x00\x00\x00\x00TEST"), "test-offset"},
+		{[]byte("GIF89a\xff\xfe"), "test-confidence"},
+		{[]byte("GIF89a\x01\x00\x01\x00"), "gif"},
+		{far, ""},
+	} {
+		if _, name, _ := d.DecodeSize(bytes.NewReader(tc.b)); name != tc.name {
+			t.Errorf("%q: got %q, want %q", tc.b[:12], name, tc.name)
+		}
+	}
+
+	d.SetPeekLimit(2048)
+	if _, name, err := d.DecodeSize(bytes.NewReader(far)); err != nil || name != "test-far" {
+		t.Errorf("got %s, %v", name, err)
+	}
+}
+
+func TestDecoder(t *testing.T) {
+	d := NewDecoder("jpeg", "png", "gif", "webp")
+	if got := strings.Join(d.List(), " "); got != "jpeg png gif webp" {
+		t.Errorf("List() = %q", got)
+	}
+	for _, tc := range []struct {
+		file, name string
+	}{
+		{"testdata/test.png", "png"},
+		{"testdata/test.bmp", ""},
+		{"testdata/test.tiff", ""},
+	} {
+		b, err := os.ReadFile(tc.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, name, err := d.DecodeSize(bytes.NewReader(b))
+		if name != tc.name || (tc.name == "") != (err == ErrFormat) {
+			t.Errorf("%s: got %q, %v", tc.file, name, err)
+		}
+	}
+
+	// Formats registered with a Decoder stay there.
+	d.Register(Format{Name: "test-decoder", Magics: []Magic{{0, "TESTDEC"}}, DecodeSize: func(io.Reader) (Size, error) {
+		return Size{2, 2}, nil
+	}})
+	if _, name, err := d.DecodeSize(strings.NewReader("TESTDEC")); err != nil || name != "test-decoder" {
+		t.Errorf("got %q, %v", name, err)
+	}
+	if _, _, err := DecodeSize(strings.NewReader("TESTDEC")); err != ErrFormat {
+		t.Errorf("default decoder: got %v", err)
+	}
+	if !d.Unregister("png") || d.Unregister("png") {
+		t.Error("Unregister did not report the formats removed")
+	}
+	f, err := os.Open("testdata/test.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, _, err := d.DecodeSize(f); err != ErrFormat {
+		t.Errorf("unregistered png: got %v", err)
+	}
+}
+
+func TestDecoderAllow(t *testing.T) {
+	d := NewDecoder()
+	decoded := 0
+	d.Register(Format{Name: "test-untrusted", Magics: []Magic{{0, "UNTRUSTED"}}, DecodeSize: func(io.Reader) (Size, error) {
+		decoded++
+		return Size{1, 1}, nil
+	}})
+	d.Allow("jpeg", "png", "gif", "webp")
+	for _, tc := range []struct {
+		b    []byte
+		name string
+	}{
+		{[]byte("UNTRUSTED"), "test-untrusted"},
+		{[]byte("BM\x00\x00\x00\x00\x00\x00\x00\x00"), "bmp"},
+	} {
+		_, name, err := d.DecodeSize(bytes.NewReader(tc.b))
+		if name != tc.name || err != DisallowedFormatError(tc.name) {
+			t.Errorf("%q: got %q, %v", tc.b, name, err)
+		}
+	}
+	f, err := os.Open("testdata/test.gif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, name, err := d.DecodeSize(f); err != nil || name != "gif" {
+		t.Errorf("got %q, %v", name, err)
+	}
+
+	d.Allow()
+	d.Deny("gif")
+	if _, _, err := d.DecodeSize(strings.NewReader("GIF89a")); err != DisallowedFormatError("gif") {
+		t.Errorf("denied gif: got %v", err)
+	}
+	if decoded != 0 {
+		t.Error("disallowed format decoded")
+	}
+	if _, name, err := d.DecodeSize(strings.NewReader("UNTRUSTED")); err != nil || name != "test-untrusted" || decoded != 1 {
+		t.Errorf("got %q, %v", name, err)
+	}
+
+	// The other entry points of d apply the same restriction, and only
+	// know the formats of d.
+	d.Deny("gif", "tiff", "ico", "dds", "exr", "j2k", "svg")
+	decoders := []func(io.Reader) (string, error){
+		func(r io.Reader) (string, error) { _, name, err := d.DecodeAnimation(r); return name, err },
+		func(r io.Reader) (string, error) { _, name, err := d.DecodeExif(r); return name, err },
+		func(r io.Reader) (string, error) { _, name, err := d.DecodeRAW(r); return name, err },
+		func(r io.Reader) (string, error) { _, name, err := d.DecodeIcons(r); return name, err },
+		func(r io.Reader) (string, error) { _, name, err := d.DecodeTexture(r); return name, err },
+		func(r io.Reader) (string, error) { _, name, err := d.DecodeTIFFPages(r); return name, err },
+		func(r io.Reader) (string, error) { _, name, err := d.DecodeEXR(r); return name, err },
+		func(r io.Reader) (string, error) { _, name, err := d.DecodeJPEG2000(r); return name, err },
+		func(r io.Reader) (string, error) { _, name, err := d.DecodeSVG(r); return name, err },
+	}
+	for i, tc := range []struct{ b, name string }{
+		{"GIF89a", "gif"},
+		{leHeader, "tiff"},
+		{leHeader, "tiff"},
+		{"\x00\x00\x01\x00\x01\x00", "ico"},
+		{ddsHeader, "dds"},
+		{leHeader, "tiff"},
+		{exrHeader, "exr"},
+		{j2kHeader, "j2k"},
+		{`<svg width="1" height="1"/>`, "svg"},
+	} {
+		if name, err := decoders[i](strings.NewReader(tc.b)); name != tc.name || err != DisallowedFormatError(tc.name) {
+			t.Errorf("%q: got %q, %v", tc.b, name, err)
+		}
+	}
+	d.Unregister("gif")
+	if name, err := decoders[0](strings.NewReader("GIF89a")); name != "" || err != ErrFormat {
+		t.Errorf("unregistered gif: got %q, %v", name, err)
+	}
+	d.Deny()
+	if svg, name, err := d.DecodeSVG(strings.NewReader(`<svg width="3" height="2"/>`)); err != nil || name != "svg" || svg.Size != (Size{3, 2}) {
+		t.Errorf("got %q, %+v, %v", name, svg, err)
+	}
+	if _, name, err := d.DecodeEXR(strings.NewReader(`<svg width="3" height="2"/>`)); name != "svg" || err == nil {
+		t.Errorf("svg read as EXR: got %q, %v", name, err)
+	}
+}
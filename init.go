@@ -3,20 +3,53 @@ package imgsz
 import "io"
 
 func init() {
-	RegisterFormat("jpeg", "\xff\xd8", func(r io.Reader) (Size, error) {
+	registerInfo("jpeg", "\xff\xd8", func(r io.Reader) (Info, error) {
 		var d jpgdecoder
 		return d.decode(r)
 	})
-	RegisterFormat("png", pngHeader, decodepng)
-	RegisterFormat("gif", "GIF8?a", func(r io.Reader) (Size, error) {
-		var d gifdecoder
-		if err := d.readHeaderAndScreenDescriptor(r); err != nil {
-			return Size{}, err
-		}
-		return Size{d.width, d.height}, nil
-	})
-	RegisterFormat("webp", "RIFF????WEBPVP8", decodewebp)
-	RegisterFormat("bmp", "BM????\x00\x00\x00\x00", decodebmp)
-	RegisterFormat("tiff", leHeader, decodetiff)
-	RegisterFormat("tiff", beHeader, decodetiff)
+	registerInfo("png", pngHeader, decodepng)
+	registerInfo("gif", "GIF8?a", decodegif)
+	registerInfo("webp", "RIFF????WEBPVP8", decodewebp)
+	registerInfo("bmp", "BM????\x00\x00\x00\x00", decodebmp)
+	registerInfo("tiff", leHeader, decodetiff)
+	registerInfo("tiff", beHeader, decodetiff)
+	registerInfo("tiff", leBigHeader, decodetiff)
+	registerInfo("tiff", beBigHeader, decodetiff)
+	registerInfo("orf", orfHeader, rawInfo(decodeTIFFRAW))
+	registerInfo("orf", orfHeaderS, rawInfo(decodeTIFFRAW))
+	registerInfo("orf", orfHeaderBE, rawInfo(decodeTIFFRAW))
+	registerInfo("rw2", rw2Header, rawInfo(decodeTIFFRAW))
+	registerSniffer("ico", icoSniffer(icoHeader), decodeico)
+	registerSniffer("cur", icoSniffer(curHeader), decodeico)
+	registerInfo("icns", icnsHeader, decodeicns)
+	registerInfo("qoi", qoiHeader, decodeqoi)
+	registerInfo("farbfeld", farbfeldHeader, decodefarbfeld)
+	registerInfo("dds", ddsHeader, textureInfo(decodeDDS))
+	registerInfo("ktx", ktxHeader, textureInfo(decodeKTX))
+	registerInfo("ktx2", ktx2Header, textureInfo(decodeKTX2))
+	registerInfo("exr", exrHeader, decodeexr)
+	registerInfo("hdr", hdrHeader, decodehdr)
+	registerInfo("hdr", hdrHeaderRGBE, decodehdr)
+	registerInfo("jp2", jp2Header, decodejp2)
+	registerInfo("j2k", j2kHeader, decodej2k)
+	registerInfo("psd", psdHeader, decodepsd)
+	registerInfo("psb", psbHeader, decodepsd)
+	registerInfo("ras", sunRasterHeader, decodesunras)
+	registerInfo("sgi", sgiHeader, decodesgi)
+	registerInfo("xpm", xpmHeader, decodexpm)
+	registerInfo("xpm", xpm2Header, decodexpm)
+	registerMagics("dicom", []Magic{{dicomPreambleLen, dicomPrefix}}, decodedicom)
+	registerInfo("fits", fitsHeader, decodefits)
+	registerSniffer("svgz", svgzSniff, decodesvgz)
+	registerInfo("jxl", jxlCodestreamHeader, decodejxl)
+	registerInfo("jxl", jxlContainerHeader, decodejxl)
+	registerSniffer("avif", ftypSniffer("avif", "avis"), decodeheif)
+	registerSniffer("heif", ftypSniffer("heic", "heix", "mif1", "msf1"), decodeheif)
+	registerSniffer("netpbm", netpbmSniff, decodenetpbm)
+	registerSniffer("cr3", ftypSniffer("crx "), rawInfo(cr3RAW))
+	registerSniffer("pcx", pcxSniff, decodepcx)
+	registerSniffer("xbm", xbmSniff, decodexbm)
+	registerFallback("tga", tgaValidate, decodetga)
+	registerFallback("wbmp", wbmpSniff, decodewbmp)
+	registerFallback("svg", svgSniff, decodesvg)
 }
@@ -0,0 +1,253 @@
+// JPEG 2000 is defined in ISO/IEC 15444-1. A JP2 file wraps the codestream
+// in boxes like those of the ISO base media file format, and keeps the image
+// header in the jp2h box. JPX and JPH files, of parts 2 and 15, share that
+// layout. A raw J2K codestream starts with an SOC marker, followed by the
+// SIZ marker segment that describes the image and its tiles.
+
+package imgsz
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+)
+
+const (
+	jp2Header = "\x00\x00\x00\x0cjP  \r\n\x87\n"
+	j2kHeader = "\xff\x4f\xff\x51" // SOC and SIZ markers.
+
+	j2kMaxComponents = 16384
+)
+
+var (
+	fccColr = fourCC{'c', 'o', 'l', 'r'}
+	fccIhdr = fourCC{'i', 'h', 'd', 'r'}
+	fccJp2c = fourCC{'j', 'p', '2', 'c'}
+	fccJp2h = fourCC{'j', 'p', '2', 'h'}
+	fccJP   = fourCC{'j', 'P', ' ', ' '}
+)
+
+// JPEG2000Info describes the image header of a JPEG 2000 codestream.
+type JPEG2000Info struct {
+	// Size is the size of the image area of the reference grid.
+	Size
+	Components int
+	// BitDepth is the bit depth of the components, the largest one if
+	// they differ, and Signed reports signed samples.
+	BitDepth int
+	Signed   bool
+	// TileSize is the nominal size of a tile, and Tiles the number of
+	// tiles across and down.
+	TileSize Size
+	Tiles    Size
+}
+
+// parseJ2KSIZ parses the payload of a SIZ marker segment, which follows its
+// length.
+func parseJ2KSIZ(b []byte) (JPEG2000Info, error) {
+	if len(b) < 36 {
+		return JPEG2000Info{}, FormatError("short SIZ marker segment")
+	}
+	var v [8]uint32
+	for i := range v {
+		v[i] = binary.BigEndian.Uint32(b[2+4*i:])
+	}
+	xsiz, ysiz, xosiz, yosiz, xtsiz, ytsiz, xtosiz, ytosiz := v[0], v[1], v[2], v[3], v[4], v[5], v[6], v[7]
+	// The first tile must hold the top-left pixel of the image area.
+	if xosiz >= xsiz || yosiz >= ysiz || xtsiz == 0 || ytsiz == 0 ||
+		xtosiz > xosiz || ytosiz > yosiz || uint64(xtosiz)+uint64(xtsiz) <= uint64(xosiz) ||
+		uint64(ytosiz)+uint64(ytsiz) <= uint64(yosiz) {
+		return JPEG2000Info{}, FormatError("bad SIZ marker segment")
+	}
+	c := int(binary.BigEndian.Uint16(b[34:36]))
+	if c == 0 || c > j2kMaxComponents || len(b) < 36+3*c {
+		return JPEG2000Info{}, FormatError("bad SIZ component count")
+	}
+	info := JPEG2000Info{
+		Size:       Size{int(xsiz - xosiz), int(ysiz - yosiz)},
+		Components: c,
+		TileSize:   Size{int(xtsiz), int(ytsiz)},
+		Tiles: Size{
+			int((uint64(xsiz-xtosiz) + uint64(xtsiz) - 1) / uint64(xtsiz)),
+			int((uint64(ysiz-ytosiz) + uint64(ytsiz) - 1) / uint64(ytsiz)),
+		},
+	}
+	for i := 0; i < c; i++ {
+		// Ssiz holds the bit depth less one, and the sign in its high bit.
+		ssiz := b[36+3*i]
+		if d := int(ssiz&0x7f) + 1; d > info.BitDepth {
+			info.BitDepth = d
+		}
+		if ssiz&0x80 != 0 {
+			info.Signed = true
+		}
+	}
+	return info, nil
+}
+
+// readJ2K reads the SOC marker and the SIZ marker segment at the start of a
+// codestream.
+func readJ2K(r io.Reader) (JPEG2000Info, error) {
+	var b [6]byte
+	if err := readFull(r, b[:]); err != nil {
+		return JPEG2000Info{}, err
+	}
+	if string(b[:4]) != j2kHeader {
+		return JPEG2000Info{}, FormatError("missing SOC and SIZ markers")
+	}
+	n := int(binary.BigEndian.Uint16(b[4:6]))
+	if n < 2 {
+		return JPEG2000Info{}, FormatError("bad SIZ marker segment length")
+	}
+	siz := make([]byte, n-2)
+	if err := readFull(r, siz); err != nil {
+		return JPEG2000Info{}, err
+	}
+	return parseJ2KSIZ(siz)
+}
+
+// decodej2k returns the image header of a J2K codestream.
+func decodej2k(r io.Reader) (Info, error) {
+	j, err := readJ2K(r)
+	if err != nil {
+		return Info{}, err
+	}
+	info := Info{
+		Size:         j.Size,
+		BitDepth:     j.BitDepth,
+		Channels:     j.Components,
+		SampleFormat: SampleUint,
+		Frames:       1,
+	}
+	if j.Signed {
+		info.SampleFormat = SampleInt
+	}
+	return info, nil
+}
+
+// parseJP2Ihdr parses the payload of an ihdr box.
+func parseJP2Ihdr(b []byte) (Info, error) {
+	if len(b) < 14 {
+		return Info{}, FormatError("short ihdr box")
+	}
+	info := Info{
+		Size: Size{
+			Width:  int(binary.BigEndian.Uint32(b[4:8])),
+			Height: int(binary.BigEndian.Uint32(b[0:4])),
+		},
+		Channels:     int(binary.BigEndian.Uint16(b[8:10])),
+		SampleFormat: SampleUint,
+		Frames:       1,
+	}
+	if info.Width <= 0 || info.Height <= 0 || info.Channels == 0 {
+		return Info{}, FormatError("bad ihdr box")
+	}
+	// A bit depth of 255 means that the components differ, and a bpcc box
+	// lists them. Otherwise, the high bit marks signed samples.
+	if bpc := b[10]; bpc != 0xff {
+		info.BitDepth = int(bpc&0x7f) + 1
+		if bpc&0x80 != 0 {
+			info.SampleFormat = SampleInt
+		}
+	}
+	return info, nil
+}
+
+// jp2ColorSpace fills in the color model that the colr box b gives by an
+// enumerated color space.
+func jp2ColorSpace(info *Info, b []byte) {
+	if len(b) < 7 || b[0] != 1 {
+		return
+	}
+	switch binary.BigEndian.Uint32(b[3:7]) {
+	case 16:
+		info.ColorModel, info.ColorSpace = ColorRGB, ColorSpaceSRGB
+	case 17:
+		info.ColorModel = ColorGray
+	case 18:
+		info.ColorModel = ColorYCbCr
+	}
+}
+
+// findJP2Box checks the signature box of a JP2 file, and skips the boxes
+// that precede the first one of type typ. It returns the payload length of
+// that box.
+func findJP2Box(r io.Reader, typ fourCC) (int64, error) {
+	for first := true; ; first = false {
+		t, n, err := readBoxHeader(r)
+		if err == io.EOF {
+			return 0, FormatError("missing " + string(typ[:]) + " box")
+		}
+		if err != nil {
+			return 0, err
+		}
+		if first && t != fccJP {
+			return 0, FormatError("missing JPEG 2000 signature box")
+		}
+		if t == typ {
+			return n, nil
+		}
+		if n < 0 {
+			return 0, FormatError("missing " + string(typ[:]) + " box")
+		}
+		if _, err := io.CopyN(io.Discard, r, n); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+	}
+}
+
+// decodejp2 returns the image header of a JP2 file.
+func decodejp2(r io.Reader) (Info, error) {
+	n, err := findJP2Box(r, fccJp2h)
+	if err != nil {
+		return Info{}, err
+	}
+	b, err := readBox(r, n)
+	if err != nil {
+		return Info{}, err
+	}
+	ihdr, ok := findBox(b, fccIhdr)
+	if !ok {
+		return Info{}, FormatError("missing ihdr box")
+	}
+	info, err := parseJP2Ihdr(ihdr)
+	if err != nil {
+		return Info{}, err
+	}
+	if colr, ok := findBox(b, fccColr); ok {
+		jp2ColorSpace(&info, colr)
+	}
+	return info, nil
+}
+
+// DecodeJPEG2000 reads the image header of a JP2, JPX or JPH file, or of a
+// raw J2K codestream, such as one embedded in an ICNS or PDF file. It does
+// not need the format to be registered, nor detect it, so no Decoder
+// restricts it; Decoder.DecodeJPEG2000 does.
+func DecodeJPEG2000(r io.Reader) (JPEG2000Info, error) {
+	br := bufio.NewReader(r)
+	if b, _ := br.Peek(len(jp2Header)); string(b) == jp2Header {
+		if _, err := findJP2Box(br, fccJp2c); err != nil {
+			return JPEG2000Info{}, err
+		}
+	}
+	return readJ2K(br)
+}
+
+// DecodeJPEG2000 is like the DecodeJPEG2000 function, but only reads the
+// images that d detects as JP2 or J2K and allows. The string returned is
+// the format name.
+func (d *Decoder) DecodeJPEG2000(r io.Reader) (JPEG2000Info, string, error) {
+	rr, f, err := d.detect(r)
+	if err != nil {
+		return JPEG2000Info{}, f.name, err
+	}
+	if f.name != "jp2" && f.name != "j2k" {
+		return JPEG2000Info{}, f.name, UnsupportedError("JPEG 2000 header of " + f.name)
+	}
+	info, err := DecodeJPEG2000(rr)
+	return info, f.name, err
+}
@@ -18,6 +18,7 @@ const (
 	sof0Marker = 0xc0 // Start Of Frame (Baseline Sequential).
 	sof1Marker = 0xc1 // Start Of Frame (Extended Sequential).
 	sof2Marker = 0xc2 // Start Of Frame (Progressive).
+	sof3Marker = 0xc3 // Start Of Frame (Lossless).
 	dhtMarker  = 0xc4 // Define Huffman Table.
 	rst0Marker = 0xd0 // ReSTart (0).
 	rst7Marker = 0xd7 // ReSTart (7).
@@ -31,6 +32,7 @@ const (
 	// but in practice, their use is described at
 	// https://www.sno.phy.queensu.ca/~phil/exiftool/TagNames/JPEG.html
 	app0Marker  = 0xe0
+	app1Marker  = 0xe1
 	app14Marker = 0xee
 	app15Marker = 0xef
 )
@@ -73,6 +75,11 @@ type jpgdecoder struct {
 
 	jfif bool
 
+	// exif is the EXIF data of an APP1 segment, and orientation its
+	// Orientation tag.
+	exif        []byte
+	orientation int
+
 	tmp [2 * blockSize]byte
 }
 
@@ -216,23 +223,57 @@ func (d *jpgdecoder) processSOF(n int) error {
 	return nil
 }
 
-// decode reads a JPEG image from r and returns its Size
-func (d *jpgdecoder) decode(r io.Reader) (Size, error) {
+// processApp1 reads an APP1 segment and, if it holds EXIF data, records its
+// orientation. Malformed EXIF data is ignored, as it does not affect the size.
+func (d *jpgdecoder) processApp1(n int) error {
+	b := make([]byte, n)
+	if err := d.readFull(b); err != nil {
+		return err
+	}
+	if d.exif == nil && len(b) > len(exifHeader) && string(b[:len(exifHeader)]) == exifHeader {
+		d.exif = b[len(exifHeader):]
+		d.orientation = exifOrientation(d.exif)
+	}
+	return nil
+}
+
+// info returns what the SOF and APP1 markers told about the image.
+func (d *jpgdecoder) info() Info {
+	info := Info{
+		Size:        Size{d.width, d.height},
+		BitDepth:    8,
+		Interlaced:  d.progressive,
+		Frames:      1,
+		Orientation: d.orientation,
+	}
+	switch d.nComp {
+	case 1:
+		info.ColorModel = ColorGray
+	case 3:
+		info.ColorModel = ColorYCbCr
+	case 4:
+		info.ColorModel = ColorCMYK
+	}
+	return info
+}
+
+// decode reads a JPEG image from r and returns its Info.
+func (d *jpgdecoder) decode(r io.Reader) (Info, error) {
 	d.r = r
 
 	// Check for the Start Of Image marker.
 	if err := d.readFull(d.tmp[:2]); err != nil {
-		return Size{}, err
+		return Info{}, err
 	}
 	if d.tmp[0] != 0xff || d.tmp[1] != soiMarker {
-		return Size{}, FormatError("missing SOI marker")
+		return Info{}, FormatError("missing SOI marker")
 	}
 
 	// Process the remaining segments until the End Of Image marker.
 	for {
 		err := d.readFull(d.tmp[:2])
 		if err != nil {
-			return Size{}, err
+			return Info{}, err
 		}
 		for d.tmp[0] != 0xff {
 			// Strictly speaking, this is a format error. However, libjpeg is
@@ -258,7 +299,7 @@ func (d *jpgdecoder) decode(r io.Reader) (Size, error) {
 			d.tmp[0] = d.tmp[1]
 			d.tmp[1], err = d.readByte()
 			if err != nil {
-				return Size{}, err
+				return Info{}, err
 			}
 		}
 		marker := d.tmp[1]
@@ -271,7 +312,7 @@ func (d *jpgdecoder) decode(r io.Reader) (Size, error) {
 			// number of fill bytes, which are bytes assigned code X'FF'".
 			marker, err = d.readByte()
 			if err != nil {
-				return Size{}, err
+				return Info{}, err
 			}
 		}
 		if marker == eoiMarker { // End Of Image.
@@ -290,11 +331,11 @@ func (d *jpgdecoder) decode(r io.Reader) (Size, error) {
 		// Read the 16-bit length of the segment. The value includes the 2 bytes for the
 		// length itself, so we subtract 2 to get the number of remaining bytes.
 		if err = d.readFull(d.tmp[:2]); err != nil {
-			return Size{}, err
+			return Info{}, err
 		}
 		n := int(d.tmp[0])<<8 + int(d.tmp[1]) - 2
 		if n < 0 {
-			return Size{}, FormatError("short segment length")
+			return Info{}, FormatError("short segment length")
 		}
 
 		switch marker {
@@ -303,11 +344,13 @@ func (d *jpgdecoder) decode(r io.Reader) (Size, error) {
 			d.progressive = marker == sof2Marker
 			err = d.processSOF(n)
 			if d.jfif {
-				return Size{}, err
+				return Info{}, err
 			}
-			return Size{d.width, d.height}, nil
+			return d.info(), nil
 		case sosMarker:
-			return Size{}, nil
+			return Info{}, nil
+		case app1Marker:
+			err = d.processApp1(n)
 		case dhtMarker, dqtMarker, driMarker, app0Marker, app14Marker:
 			err = d.ignore(n)
 		default:
@@ -320,8 +363,8 @@ func (d *jpgdecoder) decode(r io.Reader) (Size, error) {
 			}
 		}
 		if err != nil {
-			return Size{}, err
+			return Info{}, err
 		}
 	}
-	return Size{d.width, d.height}, nil
+	return d.info(), nil
 }
@@ -0,0 +1,362 @@
+// JPEG XL is defined in ISO/IEC 18181. A file is either a bare codestream or
+// a codestream wrapped in ISOBMFF boxes (ISO/IEC 18181-2).
+
+package imgsz
+
+import (
+	"bufio"
+	"io"
+)
+
+const (
+	jxlCodestreamHeader = "\xff\x0a"
+	jxlContainerHeader  = "\x00\x00\x00\x0cJXL \x0d\x0a\x87\x0a"
+)
+
+var (
+	fccJXL  = fourCC{'J', 'X', 'L', ' '}
+	fccJxlc = fourCC{'j', 'x', 'l', 'c'}
+	fccJxlp = fourCC{'j', 'x', 'l', 'p'}
+)
+
+// jxlRatios are the width:height ratios selected by the SizeHeader's ratio
+// field, indexed by ratio-1.
+var jxlRatios = [7][2]uint64{{1, 1}, {12, 10}, {4, 3}, {3, 2}, {16, 9}, {5, 4}, {2, 1}}
+
+// jxldecoder reads the codestream headers. Like VP8L, JPEG XL packs its
+// bit-stream least significant bit first.
+type jxldecoder struct {
+	vp8ldecoder
+}
+
+// read reads the next n bits, for n up to 32, in pieces that the VP8L
+// accumulator can hold.
+func (d *jxldecoder) read(n uint32) (uint32, error) {
+	if n <= 16 {
+		return d.vp8ldecoder.read(n)
+	}
+	lo, err := d.vp8ldecoder.read(16)
+	if err != nil {
+		return 0, err
+	}
+	hi, err := d.vp8ldecoder.read(n - 16)
+	if err != nil {
+		return 0, err
+	}
+	return lo | hi<<16, nil
+}
+
+// u32 reads a U32 field: a 2-bit selector followed by nbits[selector] bits,
+// to which dist[selector] is added.
+func (d *jxldecoder) u32(dist, nbits [4]uint32) (uint32, error) {
+	sel, err := d.read(2)
+	if err != nil {
+		return 0, err
+	}
+	v, err := d.read(nbits[sel])
+	if err != nil {
+		return 0, err
+	}
+	return dist[sel] + v, nil
+}
+
+// dim reads a SizeHeader dimension, which is either a multiple of 8 or an
+// arbitrary U32.
+func (d *jxldecoder) dim(div8 bool) (uint64, error) {
+	if div8 {
+		v, err := d.read(5)
+		return 8 * (uint64(v) + 1), err
+	}
+	v, err := d.u32([4]uint32{1, 1, 1, 1}, [4]uint32{9, 13, 18, 30})
+	return uint64(v), err
+}
+
+// sizeHeader decodes the SizeHeader that follows the codestream signature.
+func (d *jxldecoder) sizeHeader() (Size, error) {
+	div8, err := d.read(1)
+	if err != nil {
+		return Size{}, err
+	}
+	h, err := d.dim(div8 == 1)
+	if err != nil {
+		return Size{}, err
+	}
+	ratio, err := d.read(3)
+	if err != nil {
+		return Size{}, err
+	}
+	var w uint64
+	if ratio == 0 {
+		if w, err = d.dim(div8 == 1); err != nil {
+			return Size{}, err
+		}
+	} else {
+		r := jxlRatios[ratio-1]
+		w = h * r[0] / r[1]
+	}
+	return Size{int(w), int(h)}, nil
+}
+
+// previewHeader skips a PreviewHeader, which has its own dimension encoding.
+func (d *jxldecoder) previewHeader() error {
+	div8, err := d.read(1)
+	if err != nil {
+		return err
+	}
+	dist, nbits := [4]uint32{1, 65, 321, 1345}, [4]uint32{6, 8, 10, 12}
+	if div8 == 1 {
+		dist, nbits = [4]uint32{16, 32, 1, 33}, [4]uint32{0, 0, 5, 9}
+	}
+	if _, err := d.u32(dist, nbits); err != nil {
+		return err
+	}
+	ratio, err := d.read(3)
+	if err == nil && ratio == 0 {
+		_, err = d.u32(dist, nbits)
+	}
+	return err
+}
+
+// bitDepth reads a BitDepth bundle and returns the bits per sample.
+func (d *jxldecoder) bitDepth() (uint32, error) {
+	float, err := d.read(1)
+	if err != nil {
+		return 0, err
+	}
+	if float == 0 {
+		return d.u32([4]uint32{8, 10, 12, 1}, [4]uint32{0, 0, 0, 6})
+	}
+	bits, err := d.u32([4]uint32{32, 16, 24, 1}, [4]uint32{0, 0, 0, 6})
+	if err != nil {
+		return 0, err
+	}
+	// Skip the exponent bits.
+	_, err = d.read(4)
+	return bits, err
+}
+
+// Extra channel types.
+const (
+	jxlAlpha     = 0
+	jxlSpotColor = 2
+	jxlCFA       = 5
+)
+
+// imageMetadata decodes the ImageMetadata bundle that follows the SizeHeader,
+// up to and including the color space of its ColorEncoding.
+func (d *jxldecoder) imageMetadata(info *Info) error {
+	info.BitDepth = 8
+	info.ColorModel = ColorRGB
+	allDefault, err := d.read(1)
+	if err != nil || allDefault == 1 {
+		return err
+	}
+	extraFields, err := d.read(1)
+	if err != nil {
+		return err
+	}
+	if extraFields == 1 {
+		// The orientation has the same meaning as in EXIF.
+		o, err := d.read(3)
+		if err != nil {
+			return err
+		}
+		info.Orientation = int(o) + 1
+		if have, err := d.read(1); err != nil {
+			return err
+		} else if have == 1 {
+			// The intrinsic size is a hint for rendering only.
+			if _, err := d.sizeHeader(); err != nil {
+				return err
+			}
+		}
+		if have, err := d.read(1); err != nil {
+			return err
+		} else if have == 1 {
+			if err := d.previewHeader(); err != nil {
+				return err
+			}
+		}
+		if have, err := d.read(1); err != nil {
+			return err
+		} else if have == 1 {
+			info.Animated = true
+			// Skip the AnimationHeader: the ticks per second as a
+			// fraction, the number of loops and the have_timecodes flag.
+			if _, err := d.u32([4]uint32{100, 1000, 1, 1}, [4]uint32{0, 0, 10, 30}); err != nil {
+				return err
+			}
+			if _, err := d.u32([4]uint32{1, 1001, 1, 1}, [4]uint32{0, 0, 8, 10}); err != nil {
+				return err
+			}
+			if _, err := d.u32([4]uint32{0, 0, 0, 0}, [4]uint32{0, 3, 16, 32}); err != nil {
+				return err
+			}
+			if _, err := d.read(1); err != nil {
+				return err
+			}
+		}
+	}
+	bits, err := d.bitDepth()
+	if err != nil {
+		return err
+	}
+	info.BitDepth = int(bits)
+	// Skip modular_16_bit_buffers.
+	if _, err := d.read(1); err != nil {
+		return err
+	}
+	n, err := d.u32([4]uint32{0, 1, 2, 1}, [4]uint32{0, 0, 4, 12})
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < n; i++ {
+		if err := d.extraChannelInfo(info); err != nil {
+			return err
+		}
+	}
+	// Skip xyb_encoded.
+	if _, err := d.read(1); err != nil {
+		return err
+	}
+	allDefault, err = d.read(1)
+	if err != nil || allDefault == 1 {
+		return err
+	}
+	// Skip want_icc, then read the color space enum.
+	if _, err := d.read(1); err != nil {
+		return err
+	}
+	cs, err := d.u32([4]uint32{0, 1, 2, 18}, [4]uint32{0, 0, 4, 6})
+	if err != nil {
+		return err
+	}
+	switch cs {
+	case 0:
+		info.ColorModel = ColorRGB
+	case 1:
+		info.ColorModel = ColorGray
+	default:
+		info.ColorModel = ColorUnknown
+	}
+	return nil
+}
+
+// extraChannelInfo reads an ExtraChannelInfo bundle, noting alpha channels.
+func (d *jxldecoder) extraChannelInfo(info *Info) error {
+	dAlpha, err := d.read(1)
+	if err != nil {
+		return err
+	}
+	if dAlpha == 1 {
+		info.HasAlpha = true
+		return nil
+	}
+	typ, err := d.u32([4]uint32{0, 1, 2, 18}, [4]uint32{0, 0, 4, 6})
+	if err != nil {
+		return err
+	}
+	if _, err := d.bitDepth(); err != nil {
+		return err
+	}
+	// Skip dim_shift and the name.
+	if _, err := d.u32([4]uint32{0, 3, 4, 1}, [4]uint32{0, 0, 0, 3}); err != nil {
+		return err
+	}
+	nameLen, err := d.u32([4]uint32{0, 0, 16, 48}, [4]uint32{0, 4, 5, 10})
+	if err != nil {
+		return err
+	}
+	for i := uint32(0); i < nameLen; i++ {
+		if _, err := d.read(8); err != nil {
+			return err
+		}
+	}
+	switch typ {
+	case jxlAlpha:
+		info.HasAlpha = true
+		_, err = d.read(1) // alpha_associated
+	case jxlSpotColor:
+		// Skip the four F16 values of the color and its solidity.
+		_, err = d.read(32)
+		if err == nil {
+			_, err = d.read(32)
+		}
+	case jxlCFA:
+		_, err = d.u32([4]uint32{1, 0, 3, 19}, [4]uint32{0, 2, 4, 8})
+	}
+	return err
+}
+
+func decodejxlCodestream(r io.Reader) (Info, error) {
+	var sig [2]byte
+	if err := readFull(r, sig[:]); err != nil {
+		return Info{}, err
+	}
+	if string(sig[:]) != jxlCodestreamHeader {
+		return Info{}, FormatError("missing JPEG XL signature")
+	}
+	rr, ok := r.(io.ByteReader)
+	if !ok {
+		rr = bufio.NewReader(r)
+	}
+	d := &jxldecoder{vp8ldecoder{r: rr}}
+	size, err := d.sizeHeader()
+	if err != nil {
+		return Info{}, err
+	}
+	info := Info{Size: size}
+	// The size is already known, so a truncated ImageMetadata only leaves
+	// the remaining fields at their defaults.
+	d.imageMetadata(&info)
+	if !info.Animated {
+		info.Frames = 1
+	}
+	return info, nil
+}
+
+// decodejxl returns the dimensions of a JPEG XL image, either a bare
+// codestream or a container, without decoding the entire image.
+func decodejxl(r io.Reader) (Info, error) {
+	rr := asReader(r)
+	if b, err := rr.Peek(len(jxlCodestreamHeader)); err == nil && string(b) == jxlCodestreamHeader {
+		return decodejxlCodestream(rr)
+	}
+	for first := true; ; first = false {
+		typ, n, err := readBoxHeader(rr)
+		if err == io.EOF {
+			return Info{}, FormatError("missing codestream box")
+		}
+		if err != nil {
+			return Info{}, err
+		}
+		if first && typ != fccJXL {
+			return Info{}, FormatError("missing JPEG XL signature box")
+		}
+		var cs io.Reader = rr
+		if n >= 0 {
+			cs = io.LimitReader(rr, n)
+		}
+		switch typ {
+		case fccJxlc:
+			return decodejxlCodestream(cs)
+		case fccJxlp:
+			// Partial codestreams are preceded by a 4-byte index. The
+			// first one holds the start of the codestream.
+			var index [4]byte
+			if err := readFull(cs, index[:]); err != nil {
+				return Info{}, err
+			}
+			return decodejxlCodestream(cs)
+		}
+		if n < 0 {
+			return Info{}, FormatError("missing codestream box")
+		}
+		if _, err := io.CopyN(io.Discard, rr, n); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return Info{}, err
+		}
+	}
+}
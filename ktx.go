@@ -0,0 +1,98 @@
+// KTX files hold OpenGL textures, and KTX2 files Vulkan ones, as described
+// at https://registry.khronos.org/KTX/specs/1.0/ktxspec.v1.html and
+// https://registry.khronos.org/KTX/specs/2.0/ktxspec.v2.html. Both start
+// with a 12-byte identifier followed by fixed-size fields.
+
+package imgsz
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+const (
+	ktxHeader  = "\xabKTX 11\xbb\r\n\x1a\n"
+	ktx2Header = "\xabKTX 20\xbb\r\n\x1a\n"
+
+	ktxHeaderLen  = 64
+	ktx2HeaderLen = 48
+
+	ktxEndianness = 0x04030201
+)
+
+// ktxTexture fills in the fields that KTX and KTX2 share, in which 0 stands
+// for a dimension that the texture does not have.
+func ktxTexture(width, height, depth, layers, faces, levels uint32) (Texture, error) {
+	tex := Texture{
+		Size:      Size{int(width), int(height)},
+		Depth:     int(depth),
+		Layers:    int(layers),
+		Faces:     int(faces),
+		MipLevels: int(levels),
+	}
+	if tex.Width <= 0 || tex.Height < 0 || tex.Depth < 0 || tex.Layers < 0 ||
+		faces != 1 && faces != 6 || tex.MipLevels < 0 {
+		return Texture{}, FormatError("bad KTX header")
+	}
+	if tex.Height == 0 {
+		tex.Height = 1
+	}
+	if tex.Depth == 0 {
+		tex.Depth = 1
+	}
+	if tex.Layers == 0 {
+		tex.Layers = 1
+	}
+	// A level count of 0 asks the loader to generate the mipmaps.
+	if tex.MipLevels == 0 {
+		tex.MipLevels = 1
+	}
+	return tex, nil
+}
+
+// decodeKTX reads the header of a KTX file, in either byte order.
+func decodeKTX(r io.Reader) (Texture, Info, error) {
+	var b [ktxHeaderLen]byte
+	if err := readFull(r, b[:]); err != nil {
+		return Texture{}, Info{}, err
+	}
+	if string(b[:12]) != ktxHeader {
+		return Texture{}, Info{}, FormatError("missing KTX identifier")
+	}
+	var order binary.ByteOrder
+	switch {
+	case binary.LittleEndian.Uint32(b[12:16]) == ktxEndianness:
+		order = binary.LittleEndian
+	case binary.BigEndian.Uint32(b[12:16]) == ktxEndianness:
+		order = binary.BigEndian
+	default:
+		return Texture{}, Info{}, FormatError("bad KTX endianness")
+	}
+	tex, err := ktxTexture(
+		order.Uint32(b[36:40]), order.Uint32(b[40:44]), order.Uint32(b[44:48]),
+		order.Uint32(b[48:52]), order.Uint32(b[52:56]), order.Uint32(b[56:60]))
+	if err != nil {
+		return Texture{}, Info{}, err
+	}
+	tex.GLInternalFormat = int(order.Uint32(b[28:32]))
+	return tex, Info{Size: tex.Size, Frames: 1}, nil
+}
+
+// decodeKTX2 reads the header of a KTX2 file.
+func decodeKTX2(r io.Reader) (Texture, Info, error) {
+	var b [ktx2HeaderLen]byte
+	if err := readFull(r, b[:]); err != nil {
+		return Texture{}, Info{}, err
+	}
+	if string(b[:12]) != ktx2Header {
+		return Texture{}, Info{}, FormatError("missing KTX2 identifier")
+	}
+	tex, err := ktxTexture(
+		readUint32(b[20:24]), readUint32(b[24:28]), readUint32(b[28:32]),
+		readUint32(b[32:36]), readUint32(b[36:40]), readUint32(b[40:44]))
+	if err != nil {
+		return Texture{}, Info{}, err
+	}
+	tex.VkFormat = int(readUint32(b[12:16]))
+	return tex, Info{Size: tex.Size, Frames: 1}, nil
+}
@@ -0,0 +1,228 @@
+// Netpbm files start with an ASCII header, described at
+// https://netpbm.sourceforge.net/doc/. PBM, PGM and PPM (P1 to P6) list their
+// dimensions and maximum sample value as whitespace separated numbers, PAM
+// (P7) uses named fields, and PFM (Pf and PF) holds floating-point samples.
+
+package imgsz
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// netpbmMaxToken is the longest header token read, comments aside.
+const netpbmMaxToken = 64
+
+// netpbmSniff reports whether b starts with a Netpbm magic number followed
+// by whitespace.
+func netpbmSniff(b []byte) bool {
+	if len(b) < 3 || b[0] != 'P' || !strings.ContainsRune("1234567fF", rune(b[1])) {
+		return false
+	}
+	return isNetpbmSpace(b[2])
+}
+
+func isNetpbmSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\v' || c == '\f' || c == '\r'
+}
+
+// netpbmDepth returns the number of bits needed to hold samples up to
+// maxval.
+func netpbmDepth(maxval int) int {
+	n := 0
+	for ; maxval > 0; maxval >>= 1 {
+		n++
+	}
+	return n
+}
+
+// netpbmdecoder reads the tokens of a Netpbm header.
+type netpbmdecoder struct {
+	r   *bufio.Reader
+	eol bool // The last token ended its line.
+}
+
+// token returns the next whitespace separated token, skipping comments,
+// which run from '#' to the end of the line.
+func (d *netpbmdecoder) token() (string, error) {
+	var tok []byte
+	d.eol = false
+	for {
+		c, err := d.r.ReadByte()
+		if err != nil {
+			if err == io.EOF && len(tok) > 0 {
+				return string(tok), nil
+			}
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return "", err
+		}
+		switch {
+		case c == '#':
+			if _, err := d.line(); err != nil {
+				return "", err
+			}
+			// A comment ends a token like whitespace does.
+			if len(tok) > 0 {
+				d.eol = true
+				return string(tok), nil
+			}
+		case isNetpbmSpace(c):
+			if len(tok) > 0 {
+				d.eol = c == '\n'
+				return string(tok), nil
+			}
+		default:
+			if len(tok) == netpbmMaxToken {
+				return "", FormatError("Netpbm header token too long")
+			}
+			tok = append(tok, c)
+		}
+	}
+}
+
+// line returns the rest of the line, which must fit in the buffer of d.r,
+// without its trailing whitespace.
+func (d *netpbmdecoder) line() (string, error) {
+	b, err := d.r.ReadSlice('\n')
+	for err == bufio.ErrBufferFull {
+		// Only a comment may run that long, and it is dropped.
+		b = nil
+		_, err = d.r.ReadSlice('\n')
+	}
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// uint reads a positive integer token.
+func (d *netpbmdecoder) uint() (int, error) {
+	tok, err := d.token()
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseUint(tok, 10, 31)
+	if err != nil || n == 0 {
+		return 0, FormatError("bad Netpbm header value " + strconv.Quote(tok))
+	}
+	return int(n), nil
+}
+
+// pam reads the header of a PAM file, up to ENDHDR.
+func (d *netpbmdecoder) pam() (Info, error) {
+	info := Info{SampleFormat: SampleUint, Frames: 1}
+	var maxval int
+	for {
+		tok, err := d.token()
+		if err != nil {
+			return Info{}, err
+		}
+		switch tok {
+		case "WIDTH":
+			info.Width, err = d.uint()
+		case "HEIGHT":
+			info.Height, err = d.uint()
+		case "DEPTH":
+			info.Channels, err = d.uint()
+		case "MAXVAL":
+			maxval, err = d.uint()
+		case "TUPLTYPE":
+			// The tuple type is the rest of the line, which may be empty.
+			tok = ""
+			if !d.eol {
+				tok, err = d.line()
+			}
+			switch tok {
+			case "BLACKANDWHITE", "GRAYSCALE":
+				info.ColorModel = ColorGray
+			case "BLACKANDWHITE_ALPHA", "GRAYSCALE_ALPHA":
+				info.ColorModel, info.HasAlpha = ColorGray, true
+			case "RGB":
+				info.ColorModel = ColorRGB
+			case "RGB_ALPHA":
+				info.ColorModel, info.HasAlpha = ColorRGB, true
+			}
+		case "ENDHDR":
+			if info.Width == 0 || info.Height == 0 || info.Channels == 0 || maxval == 0 {
+				return Info{}, FormatError("missing PAM header field")
+			}
+			if maxval > 65535 {
+				return Info{}, FormatError("bad PAM MAXVAL")
+			}
+			info.BitDepth = netpbmDepth(maxval)
+			return info, nil
+		default:
+			return Info{}, FormatError("unknown PAM header field " + strconv.Quote(tok))
+		}
+		if err != nil {
+			return Info{}, err
+		}
+	}
+}
+
+// decodenetpbm returns the dimensions and sample format of a Netpbm image
+// from its header.
+func decodenetpbm(r io.Reader) (Info, error) {
+	d := &netpbmdecoder{r: bufio.NewReader(r)}
+	magic, err := d.token()
+	if err != nil {
+		return Info{}, err
+	}
+	if len(magic) != 2 || magic[0] != 'P' {
+		return Info{}, FormatError("bad Netpbm magic number")
+	}
+	if magic[1] == '7' {
+		return d.pam()
+	}
+	info := Info{SampleFormat: SampleUint, Frames: 1}
+	switch magic[1] {
+	case '1', '4':
+		info.ColorModel, info.Channels, info.BitDepth = ColorGray, 1, 1
+	case '2', '5':
+		info.ColorModel, info.Channels = ColorGray, 1
+	case '3', '6':
+		info.ColorModel, info.Channels = ColorRGB, 3
+	case 'f':
+		info.ColorModel, info.Channels = ColorGray, 1
+	case 'F':
+		info.ColorModel, info.Channels = ColorRGB, 3
+	default:
+		return Info{}, FormatError("bad Netpbm magic number")
+	}
+	if info.Width, err = d.uint(); err != nil {
+		return Info{}, err
+	}
+	if info.Height, err = d.uint(); err != nil {
+		return Info{}, err
+	}
+	switch magic[1] {
+	case 'f', 'F':
+		// The scale factor's sign gives the byte order of the 32-bit
+		// floating-point samples.
+		tok, err := d.token()
+		if err != nil {
+			return Info{}, err
+		}
+		if _, err := strconv.ParseFloat(tok, 64); err != nil {
+			return Info{}, FormatError("bad PFM scale " + strconv.Quote(tok))
+		}
+		info.BitDepth, info.SampleFormat = 32, SampleFloat
+	case '2', '3', '5', '6':
+		maxval, err := d.uint()
+		if err != nil {
+			return Info{}, err
+		}
+		if maxval > 65535 {
+			return Info{}, FormatError("bad Netpbm maxval")
+		}
+		info.BitDepth = netpbmDepth(maxval)
+	}
+	return info, nil
+}
@@ -0,0 +1,65 @@
+// PCX files start with a 128-byte header holding the bounds of the image
+// window, the bits per pixel of each plane and the number of planes. The
+// header has no signature beyond its first byte, so its fields are checked
+// when sniffing.
+
+package imgsz
+
+import "io"
+
+const pcxHeaderLen = 128
+
+// pcxSniff reports whether b starts with a plausible PCX header.
+func pcxSniff(b []byte) bool {
+	if len(b) < 12 || b[0] != 0x0a || b[2] > 1 {
+		return false
+	}
+	switch b[1] {
+	case 0, 2, 3, 4, 5:
+	default:
+		return false
+	}
+	switch b[3] {
+	case 1, 2, 4, 8:
+	default:
+		return false
+	}
+	return readUint16(b[8:10]) >= readUint16(b[4:6]) && readUint16(b[10:12]) >= readUint16(b[6:8])
+}
+
+// decodepcx returns the dimensions and pixel format of a PCX image.
+func decodepcx(r io.Reader) (Info, error) {
+	var b [pcxHeaderLen]byte
+	if err := readFull(r, b[:]); err != nil {
+		return Info{}, err
+	}
+	if !pcxSniff(b[:]) {
+		return Info{}, FormatError("bad PCX header")
+	}
+	info := Info{
+		Size: Size{
+			Width:  int(readUint16(b[8:10])) - int(readUint16(b[4:6])) + 1,
+			Height: int(readUint16(b[10:12])) - int(readUint16(b[6:8])) + 1,
+		},
+		BitDepth:     int(b[3]),
+		Channels:     1,
+		SampleFormat: SampleUint,
+		ColorModel:   ColorPalette,
+		Frames:       1,
+	}
+	switch planes := b[65]; {
+	case planes == 1 && info.BitDepth == 1:
+		info.ColorModel = ColorGray
+	case planes == 3 && info.BitDepth == 8:
+		info.Channels, info.ColorModel = 3, ColorRGB
+	case planes == 4 && info.BitDepth == 8:
+		info.Channels, info.ColorModel, info.HasAlpha = 4, ColorRGB, true
+	case planes == 1:
+	case planes >= 2 && planes <= 4 && info.BitDepth == 1:
+		// Bit planes that together index the 16-color header palette.
+		info.BitDepth = int(planes)
+	default:
+		return Info{}, FormatError("bad PCX plane count")
+	}
+	return info, nil
+}
@@ -14,6 +14,16 @@ import (
 	"hash"
 	"hash/crc32"
 	"io"
+	"time"
+)
+
+// Color type, as per the PNG spec.
+const (
+	ctGrayscale      = 0
+	ctTrueColor      = 2
+	ctPaletted       = 3
+	ctGrayscaleAlpha = 4
+	ctTrueColorAlpha = 6
 )
 
 // A cb is a combination of color type and bit depth.
@@ -72,6 +82,18 @@ type decoder struct {
 	idatLength    uint32
 	tmp           [3 * 256]byte
 	interlace     int
+
+	// From IHDR, and from the chunks that may precede the first IDAT.
+	depth, colorType int
+	transparent      bool
+	animated         bool
+	frames           int
+	exif             []byte
+
+	// From the acTL and fcTL chunks, for an animation scan.
+	plays    int
+	fcTLs    int
+	duration time.Duration
 }
 
 var chunkOrderError = FormatError("chunk out of order")
@@ -101,6 +123,7 @@ func (d *decoder) parseIHDR(length uint32) error {
 		return FormatError("invalid interlace method")
 	}
 	d.interlace = int(d.tmp[12])
+	d.depth, d.colorType = int(d.tmp[8]), int(d.tmp[9])
 
 	w := int32(binary.BigEndian.Uint32(d.tmp[0:4]))
 	h := int32(binary.BigEndian.Uint32(d.tmp[4:8]))
@@ -149,38 +172,87 @@ func (d *decoder) Read(p []byte) (int, error) {
 	return n, err
 }
 
-func (d *decoder) parseSize() (ok bool, err error) {
+// parseChunk reads the next chunk and returns its type. It records what
+// IHDR, tRNS, acTL, fcTL and eXIf say about the image, and leaves the data
+// of an IDAT chunk unread, with its length in d.idatLength.
+func (d *decoder) parseChunk() (string, error) {
 	// Read the length and chunk type.
-	if _, err = io.ReadFull(d.r, d.tmp[:8]); err != nil {
-		return
+	if _, err := io.ReadFull(d.r, d.tmp[:8]); err != nil {
+		return "", err
 	}
 	length := binary.BigEndian.Uint32(d.tmp[:4])
 	d.crc.Reset()
 	d.crc.Write(d.tmp[4:8])
 
 	// Read the chunk data.
-	switch string(d.tmp[4:8]) {
+	typ := string(d.tmp[4:8])
+	switch typ {
 	case "IHDR":
 		if d.stage != dsStart {
-			return false, chunkOrderError
+			return typ, chunkOrderError
 		}
 		d.stage = dsSeenIHDR
-		return true, d.parseIHDR(length)
+		return typ, d.parseIHDR(length)
+	case "IDAT":
+		d.idatLength = length
+		return typ, nil
+	case "eXIf":
+		if length > maxChunkSize {
+			return typ, UnsupportedError("eXIf chunk too large")
+		}
+		d.exif = make([]byte, length)
+		if _, err := io.ReadFull(d.r, d.exif); err != nil {
+			return typ, err
+		}
+		d.crc.Write(d.exif)
+		return typ, d.verifyChecksum()
+	case "tRNS":
+		d.transparent = true
+	case "acTL":
+		if length != 8 {
+			return typ, FormatError("bad acTL length")
+		}
+		if _, err := io.ReadFull(d.r, d.tmp[:8]); err != nil {
+			return typ, err
+		}
+		d.crc.Write(d.tmp[:8])
+		d.animated = true
+		d.frames = int(binary.BigEndian.Uint32(d.tmp[:4]))
+		d.plays = int(binary.BigEndian.Uint32(d.tmp[4:8]))
+		return typ, d.verifyChecksum()
+	case "fcTL":
+		if length != 26 {
+			return typ, FormatError("bad fcTL length")
+		}
+		if _, err := io.ReadFull(d.r, d.tmp[:26]); err != nil {
+			return typ, err
+		}
+		d.crc.Write(d.tmp[:26])
+		// The delay is a fraction of a second, whose denominator 0 stands
+		// for 100.
+		num := time.Duration(binary.BigEndian.Uint16(d.tmp[20:22]))
+		den := time.Duration(binary.BigEndian.Uint16(d.tmp[22:24]))
+		if den == 0 {
+			den = 100
+		}
+		d.fcTLs++
+		d.duration += num * time.Second / den
+		return typ, d.verifyChecksum()
 	}
 	if length > 0x7fffffff {
-		return false, FormatError(fmt.Sprintf("Bad chunk length: %d", length))
+		return typ, FormatError(fmt.Sprintf("Bad chunk length: %d", length))
 	}
 	// Ignore this chunk (of a known length).
 	var ignored [4096]byte
 	for length > 0 {
 		n, err := io.ReadFull(d.r, ignored[:min(len(ignored), int(length))])
 		if err != nil {
-			return false, err
+			return typ, err
 		}
 		d.crc.Write(ignored[:n])
 		length -= uint32(n)
 	}
-	return false, d.verifyChecksum()
+	return typ, d.verifyChecksum()
 }
 
 func (d *decoder) verifyChecksum() error {
@@ -204,9 +276,39 @@ func (d *decoder) checkHeader() error {
 	return nil
 }
 
+func (d *decoder) info() Info {
+	info := Info{
+		Size:       Size{d.width, d.height},
+		BitDepth:   d.depth,
+		HasAlpha:   d.transparent || d.colorType&ctGrayscaleAlpha != 0,
+		Interlaced: d.interlace == itAdam7,
+		Animated:   d.animated,
+		Frames:     1,
+	}
+	switch d.colorType {
+	case ctGrayscale:
+		info.ColorModel, info.Channels = ColorGray, 1
+	case ctGrayscaleAlpha:
+		info.ColorModel, info.Channels = ColorGray, 2
+	case ctTrueColor:
+		info.ColorModel, info.Channels = ColorRGB, 3
+	case ctTrueColorAlpha:
+		info.ColorModel, info.Channels = ColorRGB, 4
+	case ctPaletted:
+		info.ColorModel, info.Channels = ColorPalette, 1
+	}
+	if d.animated {
+		info.Frames = d.frames
+	}
+	if d.exif != nil {
+		info.Orientation = exifOrientation(d.exif)
+	}
+	return info
+}
+
 // decodepng returns the color model and dimensions of a PNG image without
 // decoding the entire image.
-func decodepng(r io.Reader) (Size, error) {
+func decodepng(r io.Reader) (Info, error) {
 	d := &decoder{
 		r:   r,
 		crc: crc32.NewIEEE(),
@@ -215,26 +317,107 @@ func decodepng(r io.Reader) (Size, error) {
 		if err == io.EOF {
 			err = io.ErrUnexpectedEOF
 		}
-		return Size{}, err
+		return Info{}, err
 	}
+	for d.stage == dsStart {
+		if _, err := d.parseChunk(); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return Info{}, err
+		}
+	}
+	// The chunks up to the first IDAT are cheap to read, and tell about
+	// transparency and animation. The size is already known, so a damaged
+	// chunk among them ends the scan rather than failing the decode.
 	for {
-		ok, err := d.parseSize()
+		typ, err := d.parseChunk()
+		if err != nil || typ == "IDAT" {
+			break
+		}
+	}
+	return d.info(), nil
+}
+
+// pngExif returns the payload of the eXIf chunk of a PNG image, or nil if
+// there is none. The chunk may come before or after the image data.
+func pngExif(r io.Reader) ([]byte, error) {
+	d := &decoder{
+		r:   r,
+		crc: crc32.NewIEEE(),
+	}
+	if err := d.checkHeader(); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	for d.exif == nil {
+		typ, err := d.parseChunk()
 		if err != nil {
 			if err == io.EOF {
 				err = io.ErrUnexpectedEOF
 			}
-			return Size{}, err
+			return nil, err
 		}
-		if ok {
-			return Size{d.width, d.height}, nil
+		switch typ {
+		case "IDAT":
+			// Skip the data and the CRC.
+			if _, err := io.CopyN(io.Discard, d.r, int64(d.idatLength)+4); err != nil {
+				if err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				return nil, err
+			}
+		case "IEND":
+			return nil, nil
 		}
-		paletted := cbPaletted(d.cb)
-		if d.stage == dsSeenIHDR && !paletted {
-			break
+	}
+	return d.exif, nil
+}
+
+// pngAnimation walks all the chunks of a PNG image, counting the frames of
+// an APNG and adding up their delays.
+func pngAnimation(r io.Reader) (Animation, error) {
+	d := &decoder{
+		r:   r,
+		crc: crc32.NewIEEE(),
+	}
+	if err := d.checkHeader(); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
 		}
-		if d.stage == dsSeenPLTE && paletted {
-			break
+		return Animation{}, err
+	}
+	for {
+		typ, err := d.parseChunk()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return Animation{}, err
+		}
+		switch typ {
+		case "IDAT":
+			// Skip the data and the CRC.
+			if _, err := io.CopyN(io.Discard, d.r, int64(d.idatLength)+4); err != nil {
+				if err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				return Animation{}, err
+			}
+		case "IEND":
+			if !d.animated {
+				return Animation{Frames: 1, LoopCount: 1}, nil
+			}
+			// The default image is only a frame if an fcTL precedes it,
+			// and then is counted with the others.
+			return Animation{
+				Animated:  true,
+				Frames:    d.fcTLs,
+				Duration:  d.duration,
+				LoopCount: d.plays,
+			}, nil
 		}
 	}
-	return Size{d.width, d.height}, nil
 }
@@ -0,0 +1,91 @@
+// PSD and PSB files start with a 26-byte header, described at
+// https://www.adobe.com/devnet-apps/photoshop/fileformatashtml/. PSB, the
+// large document format, has version 2 and allows larger dimensions.
+
+package imgsz
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+const (
+	psdHeader = "8BPS\x00\x01"
+	psbHeader = "8BPS\x00\x02"
+
+	psdHeaderLen = 26
+	psdMaxSide   = 30000
+	psbMaxSide   = 300000
+)
+
+// Color modes.
+const (
+	psdBitmap       = 0
+	psdGrayscale    = 1
+	psdIndexed      = 2
+	psdRGB          = 3
+	psdCMYK         = 4
+	psdMultichannel = 7
+	psdDuotone      = 8
+	psdLab          = 9
+)
+
+// decodepsd returns the canvas size and pixel format of a PSD or PSB file.
+func decodepsd(r io.Reader) (Info, error) {
+	var b [psdHeaderLen]byte
+	if err := readFull(r, b[:]); err != nil {
+		return Info{}, err
+	}
+	maxSide := psdMaxSide
+	switch string(b[:6]) {
+	case psdHeader:
+	case psbHeader:
+		maxSide = psbMaxSide
+	default:
+		return Info{}, FormatError("missing PSD signature")
+	}
+	info := Info{
+		Size: Size{
+			Width:  int(binary.BigEndian.Uint32(b[18:22])),
+			Height: int(binary.BigEndian.Uint32(b[14:18])),
+		},
+		Channels:     int(binary.BigEndian.Uint16(b[12:14])),
+		BitDepth:     int(binary.BigEndian.Uint16(b[22:24])),
+		SampleFormat: SampleUint,
+		Frames:       1,
+	}
+	if info.Width == 0 || info.Height == 0 || info.Width > maxSide || info.Height > maxSide {
+		return Info{}, FormatError("bad PSD dimensions")
+	}
+	if info.Channels == 0 || info.Channels > 56 {
+		return Info{}, FormatError("bad PSD channel count")
+	}
+	switch info.BitDepth {
+	case 1, 8, 16:
+	case 32:
+		info.SampleFormat = SampleFloat
+	default:
+		return Info{}, FormatError("bad PSD depth")
+	}
+	// Channels beyond those of the color mode are alpha channels.
+	colorChannels := 0
+	switch binary.BigEndian.Uint16(b[24:26]) {
+	case psdBitmap, psdGrayscale, psdDuotone:
+		info.ColorModel, colorChannels = ColorGray, 1
+	case psdIndexed:
+		info.ColorModel, colorChannels = ColorPalette, 1
+	case psdRGB:
+		info.ColorModel, colorChannels = ColorRGB, 3
+	case psdCMYK:
+		info.ColorModel, colorChannels = ColorCMYK, 4
+	case psdLab:
+		info.ColorModel, colorChannels = ColorLab, 3
+	case psdMultichannel:
+	default:
+		return Info{}, FormatError("bad PSD color mode")
+	}
+	if colorChannels > 0 && info.Channels > colorChannels {
+		info.HasAlpha = true
+	}
+	return info, nil
+}
@@ -0,0 +1,75 @@
+// QOI (https://qoiformat.org/qoi-specification.pdf) and farbfeld
+// (https://tools.suckless.org/farbfeld/) both start with a fixed header
+// holding the image size as big-endian integers.
+
+package imgsz
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+const (
+	qoiHeader      = "qoif"
+	farbfeldHeader = "farbfeld"
+)
+
+// decodeqoi returns the dimensions, channels and color space of a QOI image.
+func decodeqoi(r io.Reader) (Info, error) {
+	var b [14]byte
+	if err := readFull(r, b[:]); err != nil {
+		return Info{}, err
+	}
+	if string(b[:4]) != qoiHeader {
+		return Info{}, FormatError("missing QOI magic")
+	}
+	info := Info{
+		Size: Size{
+			Width:  int(binary.BigEndian.Uint32(b[4:8])),
+			Height: int(binary.BigEndian.Uint32(b[8:12])),
+		},
+		BitDepth:     8,
+		Channels:     int(b[12]),
+		SampleFormat: SampleUint,
+		ColorModel:   ColorRGB,
+		Frames:       1,
+	}
+	if info.Channels != 3 && info.Channels != 4 {
+		return Info{}, FormatError("bad QOI channels")
+	}
+	info.HasAlpha = info.Channels == 4
+	// The alpha channel is linear in both color spaces.
+	switch b[13] {
+	case 0:
+		info.ColorSpace = ColorSpaceSRGB
+	case 1:
+		info.ColorSpace = ColorSpaceLinear
+	default:
+		return Info{}, FormatError("bad QOI colorspace")
+	}
+	return info, nil
+}
+
+// decodefarbfeld returns the dimensions of a farbfeld image, whose pixels
+// are always 16-bit RGBA.
+func decodefarbfeld(r io.Reader) (Info, error) {
+	var b [16]byte
+	if err := readFull(r, b[:]); err != nil {
+		return Info{}, err
+	}
+	if string(b[:8]) != farbfeldHeader {
+		return Info{}, FormatError("missing farbfeld magic")
+	}
+	return Info{
+		Size: Size{
+			Width:  int(binary.BigEndian.Uint32(b[8:12])),
+			Height: int(binary.BigEndian.Uint32(b[12:16])),
+		},
+		BitDepth:     16,
+		Channels:     4,
+		SampleFormat: SampleUint,
+		ColorModel:   ColorRGB,
+		HasAlpha:     true,
+		Frames:       1,
+	}, nil
+}
@@ -0,0 +1,472 @@
+// Camera RAW files keep the sensor data next to one or more previews. Most
+// are TIFF based: DNG, CR2, NEF, ARW and PEF are plain TIFF, while ORF and
+// RW2 only differ in their version number. CR3 uses the box structure of
+// the ISO base media file format, like HEIF.
+
+package imgsz
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// Headers of the TIFF variants, and the versions that they hold.
+const (
+	orfHeader   = "IIRO"
+	orfHeaderS  = "IIRS"
+	orfHeaderBE = "MMOR"
+	rw2Header   = "IIU\x00"
+
+	orfVersion  = 0x4f52
+	orfVersionS = 0x5352
+	rw2Version  = 0x55
+)
+
+// Panasonic tags, in the IFD0 of RW2 files.
+const (
+	tPanaSensorWidth  = 2
+	tPanaSensorHeight = 3
+	tPanaTopBorder    = 4
+	tPanaLeftBorder   = 5
+	tPanaBottomBorder = 6
+	tPanaRightBorder  = 7
+	tPanaJpgFromRaw   = 46
+)
+
+const (
+	maxRAWIFDs        = 64 // The most IFDs read from a TIFF based RAW file.
+	maxRAWSubIFDDepth = 4  // How deep SubIFDs are followed.
+)
+
+var (
+	fccCMP1 = fourCC{'C', 'M', 'P', '1'}
+	fccCMT1 = fourCC{'C', 'M', 'T', '1'}
+	fccCRAW = fourCC{'C', 'R', 'A', 'W'}
+	fccJPEG = fourCC{'J', 'P', 'E', 'G'}
+	fccMdia = fourCC{'m', 'd', 'i', 'a'}
+	fccMinf = fourCC{'m', 'i', 'n', 'f'}
+	fccStbl = fourCC{'s', 't', 'b', 'l'}
+	fccStsd = fourCC{'s', 't', 's', 'd'}
+	fccTHMB = fourCC{'T', 'H', 'M', 'B'}
+	fccUUID = fourCC{'u', 'u', 'i', 'd'}
+)
+
+// RAWInfo describes the images of a camera RAW file.
+type RAWInfo struct {
+	// Raw is the size of the sensor image. For DNG, it is cropped to the
+	// DefaultCropSize or, failing that, to the ActiveArea. For RW2, it is
+	// cropped to the sensor borders.
+	Raw Size
+	// Previews are the sizes of the embedded previews and thumbnails, in
+	// the order in which they appear in the file.
+	Previews []Size
+	// Orientation is the EXIF Orientation value, or 0 if there is none.
+	Orientation int
+}
+
+// rawImage is an image found in a RAW file, and the IFD describing it if
+// the file is TIFF based.
+type rawImage struct {
+	Size
+	cfa, reduced bool
+	ifd          ExifIFD
+}
+
+// jpegFrameSize returns the size recorded in the SOF segment of an embedded
+// JPEG, whatever its coding process. The components of lossless JPEG, which
+// CR2 uses for the sensor data, are interleaved sensor columns, so they are
+// counted in the width.
+func jpegFrameSize(r io.Reader) (Size, error) {
+	br := bufio.NewReader(r)
+	var b [6]byte
+	if err := readFull(br, b[:2]); err != nil {
+		return Size{}, err
+	}
+	if b[0] != 0xff || b[1] != soiMarker {
+		return Size{}, FormatError("missing SOI marker")
+	}
+	for {
+		if err := readFull(br, b[:2]); err != nil {
+			return Size{}, err
+		}
+		if b[0] != 0xff {
+			return Size{}, FormatError("missing marker")
+		}
+		marker := b[1]
+		for marker == 0xff {
+			c, err := br.ReadByte()
+			if err != nil {
+				return Size{}, err
+			}
+			marker = c
+		}
+		if rst0Marker <= marker && marker <= rst7Marker {
+			continue
+		}
+		if marker == sosMarker || marker == eoiMarker {
+			return Size{}, FormatError("missing SOF marker")
+		}
+		if err := readFull(br, b[:2]); err != nil {
+			return Size{}, err
+		}
+		n := int(b[0])<<8 + int(b[1]) - 2
+		if n < 0 {
+			return Size{}, FormatError("short segment length")
+		}
+		// Of the 0xc0 to 0xcf markers, 0xc4, 0xc8 and 0xcc are not SOFs.
+		if marker&0xf0 == 0xc0 && marker != dhtMarker && marker != 0xc8 && marker != 0xcc {
+			if n < 6 {
+				return Size{}, FormatError("short SOF segment")
+			}
+			if err := readFull(br, b[:6]); err != nil {
+				return Size{}, err
+			}
+			s := Size{int(b[3])<<8 | int(b[4]), int(b[1])<<8 | int(b[2])}
+			if marker == sof3Marker {
+				s.Width *= int(b[5])
+			}
+			return s, nil
+		}
+		if _, err := br.Discard(n); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return Size{}, err
+		}
+	}
+}
+
+// rawImage returns the image described by ifd, if it has a size.
+func (d *tiffdecoder) rawImage(ifd ExifIFD) (img rawImage, ok bool) {
+	w, _ := ifd[tImageWidth].Int(0)
+	h, _ := ifd[tImageLength].Int(0)
+	img.Size = Size{int(w), int(h)}
+	img.ifd = ifd
+	sub, _ := ifd[tNewSubfileType].Int(0)
+	img.reduced = sub&1 != 0
+	pi, _ := ifd[tPhotometricInterpretation].Int(0)
+	img.cfa = pi == pCFA || pi == pLinearRaw
+
+	if img.Size == (Size{}) {
+		// Previews and CR2 sensor data are often JPEG streams whose size
+		// the IFD does not record.
+		off, ok1 := ifd[tJPEGInterchangeFormat].Int(0)
+		n, ok2 := ifd[tJPEGInterchangeFormatLength].Int(0)
+		if c, _ := ifd[tCompression].Int(0); !ok1 && (c == cJPEGOld || c == cJPEG) {
+			off, ok1 = ifd[tStripOffsets].Int(0)
+			n, ok2 = ifd[tStripByteCounts].Int(0)
+		}
+		if ok1 && ok2 && off > 0 && n > 0 {
+			img.Size, _ = jpegFrameSize(io.NewSectionReader(d.r, off, n))
+		}
+	}
+	return img, img.Size.Width > 0 && img.Size.Height > 0
+}
+
+// walkRAW appends the images of the IFD at offset off, of its SubIFDs and
+// of the IFDs that follow it in the chain.
+func (d *tiffdecoder) walkRAW(off int64, depth int, seen map[int64]bool, imgs *[]rawImage) {
+	for off > 0 && !seen[off] && len(seen) < maxRAWIFDs {
+		seen[off] = true
+		ifd, next, err := d.exifIFD(off)
+		if err != nil {
+			return
+		}
+		if img, ok := d.rawImage(ifd); ok {
+			*imgs = append(*imgs, img)
+		}
+		if depth < maxRAWSubIFDDepth {
+			sub := ifd[tSubIFDs]
+			for i := 0; ; i++ {
+				o, ok := sub.Int(i)
+				if !ok {
+					break
+				}
+				d.walkRAW(o, depth+1, seen, imgs)
+			}
+		}
+		off = next
+	}
+}
+
+// panasonicRaw returns the sensor size recorded in the IFD0 of an RW2
+// file, cropped to its borders.
+func panasonicRaw(ifd ExifIFD) Size {
+	w, _ := ifd[tPanaSensorWidth].Int(0)
+	h, _ := ifd[tPanaSensorHeight].Int(0)
+	top, ok1 := ifd[tPanaTopBorder].Int(0)
+	left, ok2 := ifd[tPanaLeftBorder].Int(0)
+	bottom, ok3 := ifd[tPanaBottomBorder].Int(0)
+	right, ok4 := ifd[tPanaRightBorder].Int(0)
+	if ok1 && ok2 && ok3 && ok4 && bottom > top && right > left {
+		return Size{int(right - left), int(bottom - top)}
+	}
+	return Size{int(w), int(h)}
+}
+
+// dngCrop returns the size of the raw image described by ifd once cropped
+// as a DNG reader would.
+func dngCrop(ifd ExifIFD, s Size) Size {
+	w, ok1 := ifd[tDefaultCropSize].Float(0)
+	h, ok2 := ifd[tDefaultCropSize].Float(1)
+	if ok1 && ok2 && w >= 1 && h >= 1 {
+		return Size{int(math.Round(w)), int(math.Round(h))}
+	}
+	// The ActiveArea is given as top, left, bottom and right.
+	var a [4]int64
+	for i := range a {
+		v, ok := ifd[tActiveArea].Int(i)
+		if !ok {
+			return s
+		}
+		a[i] = v
+	}
+	if a[2] > a[0] && a[3] > a[1] {
+		return Size{int(a[3] - a[1]), int(a[2] - a[0])}
+	}
+	return s
+}
+
+// tiffRAW reads the images of a TIFF based RAW file.
+func tiffRAW(r io.ReaderAt) (RAWInfo, error) {
+	d := &tiffdecoder{r: r}
+	off, err := d.readHeader()
+	if err != nil {
+		return RAWInfo{}, err
+	}
+	ifd0, _, err := d.exifIFD(off)
+	if err != nil {
+		return RAWInfo{}, err
+	}
+	info := RAWInfo{Orientation: (&Exif{IFD0: ifd0}).Orientation()}
+
+	var imgs []rawImage
+	if s := panasonicRaw(ifd0); s.Width > 0 && s.Height > 0 {
+		imgs = append(imgs, rawImage{Size: s, cfa: true})
+		if b, ok := ifd0[tPanaJpgFromRaw].Value.([]byte); ok {
+			if s, err := jpegFrameSize(bytes.NewReader(b)); err == nil {
+				imgs = append(imgs, rawImage{Size: s, reduced: true})
+			}
+		}
+	}
+	d.walkRAW(off, 0, make(map[int64]bool), &imgs)
+
+	// The sensor image is the largest one that holds CFA data, or else
+	// the largest one at full resolution.
+	best := -1
+	for _, cfa := range []bool{true, false} {
+		for i, img := range imgs {
+			if img.reduced || cfa && !img.cfa {
+				continue
+			}
+			if best < 0 || img.Width*img.Height > imgs[best].Width*imgs[best].Height {
+				best = i
+			}
+		}
+		if best >= 0 {
+			break
+		}
+	}
+	if best < 0 {
+		return info, FormatError("missing raw image")
+	}
+	for i, img := range imgs {
+		if i != best {
+			info.Previews = append(info.Previews, img.Size)
+		}
+	}
+	info.Raw = imgs[best].Size
+	if _, ok := ifd0[tDNGVersion]; ok {
+		info.Raw = dngCrop(imgs[best].ifd, info.Raw)
+	}
+	return info, nil
+}
+
+// findBox returns the payload of the box at path, each box being looked up
+// among the children of the previous one.
+func findBox(b []byte, path ...fourCC) ([]byte, bool) {
+	for _, want := range path {
+		for {
+			typ, p, rest, err := nextBox(b)
+			if err != nil {
+				return nil, false
+			}
+			if typ == want {
+				b = p
+				break
+			}
+			b = rest
+		}
+	}
+	return b, true
+}
+
+// cr3Track returns the size of the image that a CR3 track holds, and
+// whether it is raw data rather than a JPEG.
+func cr3Track(trak []byte) (s Size, raw, ok bool) {
+	stsd, ok := findBox(trak, fccMdia, fccMinf, fccStbl, fccStsd)
+	if !ok || len(stsd) < 8 {
+		return Size{}, false, false
+	}
+	// Skip the version, flags and entry count.
+	typ, p, _, err := nextBox(stsd[8:])
+	if err != nil || typ != fccCRAW || len(p) < 28 {
+		return Size{}, false, false
+	}
+	s = Size{int(binary.BigEndian.Uint16(p[24:26])), int(binary.BigEndian.Uint16(p[26:28]))}
+	// The child boxes follow the 78 bytes of a visual sample entry and 4
+	// bytes of Canon's own.
+	if len(p) < 82 {
+		return Size{}, false, false
+	}
+	for b := p[82:]; len(b) > 0; {
+		typ, _, rest, err := nextBox(b)
+		if err != nil {
+			break
+		}
+		switch typ {
+		case fccCMP1:
+			return s, true, true
+		case fccJPEG:
+			return s, false, true
+		}
+		b = rest
+	}
+	return Size{}, false, false
+}
+
+// parseCR3Moov reads the images of a CR3 file from its moov box.
+func parseCR3Moov(b []byte) (RAWInfo, error) {
+	var (
+		info RAWInfo
+		imgs []rawImage
+	)
+	for len(b) > 0 {
+		typ, p, rest, err := nextBox(b)
+		if err != nil {
+			return RAWInfo{}, err
+		}
+		b = rest
+		switch typ {
+		case fccUUID:
+			// Canon's box holds the EXIF data and the thumbnail. Their
+			// boxes follow the 16-byte UUID.
+			if len(p) < 16 {
+				continue
+			}
+			for p = p[16:]; len(p) > 0; {
+				typ, c, rest, err := nextBox(p)
+				if err != nil {
+					break
+				}
+				p = rest
+				switch {
+				case typ == fccCMT1:
+					if x, err := parseExif(bytes.NewReader(c)); err == nil {
+						info.Orientation = x.Orientation()
+					}
+				case typ == fccTHMB && len(c) >= 8:
+					// The width and height follow the version and flags.
+					s := Size{int(binary.BigEndian.Uint16(c[4:6])), int(binary.BigEndian.Uint16(c[6:8]))}
+					imgs = append(imgs, rawImage{Size: s, reduced: true})
+				}
+			}
+		case fccTrak:
+			if s, raw, ok := cr3Track(p); ok {
+				imgs = append(imgs, rawImage{Size: s, cfa: raw, reduced: !raw})
+			}
+		}
+	}
+	// There may be several raw tracks, the smaller ones being reduced
+	// resolution versions of the largest.
+	best := -1
+	for i, img := range imgs {
+		if img.cfa && (best < 0 || img.Width*img.Height > imgs[best].Width*imgs[best].Height) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return info, FormatError("missing raw track")
+	}
+	info.Raw = imgs[best].Size
+	for i, img := range imgs {
+		if i != best {
+			info.Previews = append(info.Previews, img.Size)
+		}
+	}
+	return info, nil
+}
+
+// cr3RAW reads the images of a CR3 file.
+func cr3RAW(r io.Reader) (RAWInfo, error) {
+	for first := true; ; first = false {
+		typ, n, err := readBoxHeader(r)
+		if err == io.EOF {
+			return RAWInfo{}, FormatError("missing moov box")
+		}
+		if err != nil {
+			return RAWInfo{}, err
+		}
+		if first && typ != fccFtyp {
+			return RAWInfo{}, FormatError("missing ftyp box")
+		}
+		if typ == fccMoov {
+			b, err := readBox(r, n)
+			if err != nil {
+				return RAWInfo{}, err
+			}
+			return parseCR3Moov(b)
+		}
+		if n < 0 {
+			return RAWInfo{}, FormatError("missing moov box")
+		}
+		if _, err := io.CopyN(io.Discard, r, n); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return RAWInfo{}, err
+		}
+	}
+}
+
+// rawInfo adapts a RAW reader to the format registry, the sensor image
+// standing for the whole file.
+func rawInfo(decode func(io.Reader) (RAWInfo, error)) func(io.Reader) (Info, error) {
+	return func(r io.Reader) (Info, error) {
+		raw, err := decode(r)
+		return Info{Size: raw.Raw, Orientation: raw.Orientation}, err
+	}
+}
+
+func decodeTIFFRAW(r io.Reader) (RAWInfo, error) {
+	return tiffRAW(newReaderAt(r))
+}
+
+// DecodeRAW reads the sizes of the sensor image and of the previews of a
+// camera RAW file. The string returned is the format name: DNG, CR2, NEF,
+// ARW and PEF files are reported as "tiff", the others as "orf", "rw2" or
+// "cr3".
+func DecodeRAW(r io.Reader) (RAWInfo, string, error) {
+	return defaultDecoder.DecodeRAW(r)
+}
+
+// DecodeRAW is like the DecodeRAW function, for the formats of d.
+func (d *Decoder) DecodeRAW(r io.Reader) (RAWInfo, string, error) {
+	rr, f, err := d.detect(r)
+	if err != nil {
+		return RAWInfo{}, f.name, err
+	}
+	var info RAWInfo
+	switch f.name {
+	case "tiff", "orf", "rw2":
+		info, err = decodeTIFFRAW(rr)
+	case "cr3":
+		info, err = cr3RAW(rr)
+	default:
+		return RAWInfo{}, f.name, UnsupportedError("RAW data in " + f.name)
+	}
+	return info, f.name, err
+}
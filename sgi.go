@@ -0,0 +1,61 @@
+// SGI images start with a 512-byte big-endian header, described at
+// https://paulbourke.net/dataformats/sgirgb/sgiversion.html.
+
+package imgsz
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+const (
+	sgiHeader    = "\x01\xda"
+	sgiHeaderLen = 12 // The fields that we read.
+)
+
+// decodesgi returns the dimensions and pixel format of an SGI image.
+func decodesgi(r io.Reader) (Info, error) {
+	var b [sgiHeaderLen]byte
+	if err := readFull(r, b[:]); err != nil {
+		return Info{}, err
+	}
+	if string(b[:2]) != sgiHeader {
+		return Info{}, FormatError("missing SGI magic")
+	}
+	storage, bpc := b[2], b[3]
+	if storage > 1 || bpc != 1 && bpc != 2 {
+		return Info{}, FormatError("bad SGI header")
+	}
+	xsize, ysize, zsize := binary.BigEndian.Uint16(b[6:8]), binary.BigEndian.Uint16(b[8:10]), binary.BigEndian.Uint16(b[10:12])
+	// A one-dimensional image is a single row, and a two-dimensional one
+	// has a single channel, whatever the other fields hold.
+	switch binary.BigEndian.Uint16(b[4:6]) {
+	case 1:
+		ysize, zsize = 1, 1
+	case 2:
+		zsize = 1
+	case 3:
+	default:
+		return Info{}, FormatError("bad SGI dimension")
+	}
+	if xsize == 0 || ysize == 0 || zsize == 0 {
+		return Info{}, FormatError("bad SGI dimensions")
+	}
+	info := Info{
+		Size:         Size{int(xsize), int(ysize)},
+		BitDepth:     8 * int(bpc),
+		Channels:     int(zsize),
+		SampleFormat: SampleUint,
+		ColorModel:   ColorRGB,
+		Frames:       1,
+	}
+	switch zsize {
+	case 1:
+		info.ColorModel = ColorGray
+	case 2:
+		info.ColorModel, info.HasAlpha = ColorGray, true
+	case 4:
+		info.HasAlpha = true
+	}
+	return info, nil
+}
@@ -0,0 +1,64 @@
+// Sun Raster files start with a 32-byte big-endian header, followed by an
+// optional color map.
+
+package imgsz
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+const (
+	sunRasterHeader = "\x59\xa6\x6a\x95"
+	sunRasterLen    = 32
+)
+
+// Sun Raster types and color map types.
+const (
+	rtExperimental = 0xffff
+	rmtNone        = 0
+	rmtRaw         = 2
+)
+
+// decodesunras returns the dimensions and pixel format of a Sun Raster
+// image.
+func decodesunras(r io.Reader) (Info, error) {
+	var b [sunRasterLen]byte
+	if err := readFull(r, b[:]); err != nil {
+		return Info{}, err
+	}
+	if string(b[:4]) != sunRasterHeader {
+		return Info{}, FormatError("missing Sun Raster magic")
+	}
+	var v [7]uint32
+	for i := range v {
+		v[i] = binary.BigEndian.Uint32(b[4+4*i:])
+	}
+	width, height, depth, typ, mapType := v[0], v[1], v[2], v[4], v[5]
+	if width == 0 || height == 0 || width > 1<<31-1 || height > 1<<31-1 {
+		return Info{}, FormatError("bad Sun Raster dimensions")
+	}
+	if typ > 5 && typ != rtExperimental || mapType > rmtRaw {
+		return Info{}, FormatError("bad Sun Raster type")
+	}
+	info := Info{
+		Size:         Size{int(width), int(height)},
+		SampleFormat: SampleUint,
+		Frames:       1,
+	}
+	switch depth {
+	case 1:
+		info.BitDepth, info.Channels, info.ColorModel = 1, 1, ColorGray
+	case 8:
+		info.BitDepth, info.Channels, info.ColorModel = 8, 1, ColorGray
+		if mapType != rmtNone && v[6] > 0 {
+			info.ColorModel = ColorPalette
+		}
+	case 24, 32:
+		// The fourth byte of a 32-bit pixel is padding.
+		info.BitDepth, info.Channels, info.ColorModel = 8, 3, ColorRGB
+	default:
+		return Info{}, FormatError("bad Sun Raster depth")
+	}
+	return info, nil
+}
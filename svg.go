@@ -0,0 +1,303 @@
+// SVG images are XML documents whose root is an svg element. Its width and
+// height attributes give the intrinsic size, in any CSS unit, and its
+// viewBox attribute the user coordinate system, from which the size can be
+// derived when they are missing. SVGZ files are gzip compressed SVG.
+
+package imgsz
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	svgzHeader = "\x1f\x8b\x08"
+
+	svgMaxProlog = 1 << 20 // The most bytes read up to the root element.
+	svgMaxSniff  = 1 << 16 // The most bytes inflated to sniff SVGZ.
+)
+
+// svgUnits holds the CSS pixels per unit of the absolute length units, and
+// of the font-relative ones at the default font size of 16px.
+var svgUnits = map[string]float64{
+	"":   1,
+	"px": 1,
+	"pt": 96.0 / 72,
+	"pc": 16,
+	"mm": 96 / 25.4,
+	"cm": 96 / 2.54,
+	"q":  96 / 101.6,
+	"in": 96,
+	"em": 16,
+	"ex": 8,
+}
+
+// An SVGSizeSource tells where the intrinsic size of an SVG image comes from.
+type SVGSizeSource string
+
+const (
+	SVGSizeUnknown  SVGSizeSource = ""
+	SVGSizeExplicit SVGSizeSource = "explicit"
+	SVGSizeViewBox  SVGSizeSource = "viewbox"
+)
+
+// SVGInfo describes the root element of an SVG image.
+type SVGInfo struct {
+	// Size is the intrinsic size in CSS pixels, rounded to the nearest
+	// integer. It is zero when Source is SVGSizeUnknown.
+	Size
+	// Source is SVGSizeExplicit when the width or height attribute gives
+	// the size, any missing one following the aspect ratio of the viewBox,
+	// and SVGSizeViewBox when the viewBox alone does.
+	Source SVGSizeSource
+	// ViewBox holds the min-x, min-y, width and height of the viewBox
+	// attribute, or zeros if the root element has none.
+	ViewBox [4]float64
+}
+
+// svgSniff reports whether b holds the start tag of an svg root element,
+// after the XML declaration, comments and document type declaration that
+// may come first. Other XML documents, such as XHTML or RSS, are left to
+// other formats, and so is an SVG document whose prolog is longer than the
+// peek limit.
+func svgSniff(b []byte) bool {
+	b = bytes.TrimPrefix(b, []byte("\xef\xbb\xbf"))
+	for {
+		b = bytes.TrimLeft(b, " \t\r\n")
+		var end string
+		switch {
+		case bytes.HasPrefix(b, []byte("<?")):
+			end = "?>"
+		case bytes.HasPrefix(b, []byte("<!--")):
+			end = "-->"
+		case bytes.HasPrefix(b, []byte("<!DOCTYPE")):
+			// An internal subset may hold markup declarations.
+			end = ">"
+			if i, j := bytes.IndexByte(b, '['), bytes.IndexByte(b, '>'); i >= 0 && i < j {
+				end = "]"
+			}
+		case bytes.HasPrefix(b, []byte("<")):
+			i := bytes.IndexAny(b, " \t\r\n/>")
+			if i < 0 {
+				return false
+			}
+			name := b[1:i]
+			if j := bytes.IndexByte(name, ':'); j >= 0 {
+				name = name[j+1:]
+			}
+			return string(name) == "svg"
+		default:
+			return false
+		}
+		i := bytes.Index(b, []byte(end))
+		if i < 0 {
+			return false
+		}
+		b = b[i+len(end):]
+		if end == "]" {
+			if i = bytes.IndexByte(b, '>'); i < 0 {
+				return false
+			}
+			b = b[i+1:]
+		}
+	}
+}
+
+// svgzSniff reports whether b starts a gzip stream whose inflated content
+// starts like an SVG document, as svgSniff tells.
+func svgzSniff(b []byte) bool {
+	if !bytes.HasPrefix(b, []byte(svgzHeader)) {
+		return false
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return false
+	}
+	// The compressed bytes end within the stream, so their end is no error.
+	inflated, _ := io.ReadAll(io.LimitReader(zr, svgMaxSniff))
+	return svgSniff(inflated)
+}
+
+// parseSVGLength parses a length or percentage. A percentage, whose base
+// is the viewport, is reported as not ok.
+func parseSVGLength(s string) (float64, bool) {
+	s = strings.TrimSpace(s)
+	i := 0
+	if i < len(s) && (s[i] == '+' || s[i] == '-') {
+		i++
+	}
+	for i < len(s) && (s[i] >= '0' && s[i] <= '9' || s[i] == '.') {
+		i++
+	}
+	// An exponent needs a digit, which tells it apart from the em and ex
+	// units.
+	if i+1 < len(s) && (s[i] == 'e' || s[i] == 'E') {
+		j := i + 1
+		if s[j] == '+' || s[j] == '-' {
+			j++
+		}
+		if j < len(s) && s[j] >= '0' && s[j] <= '9' {
+			for i = j; i < len(s) && s[i] >= '0' && s[i] <= '9'; i++ {
+			}
+		}
+	}
+	v, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil || v <= 0 || math.IsInf(v, 0) {
+		return 0, false
+	}
+	scale, ok := svgUnits[strings.ToLower(strings.TrimSpace(s[i:]))]
+	if !ok {
+		return 0, false
+	}
+	return v * scale, true
+}
+
+// parseViewBox parses a viewBox attribute, whose width and height must be
+// positive.
+func parseViewBox(s string) ([4]float64, bool) {
+	var vb [4]float64
+	f := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\r' || r == '\n'
+	})
+	if len(f) != 4 {
+		return vb, false
+	}
+	for i, v := range f {
+		x, err := strconv.ParseFloat(v, 64)
+		if err != nil || math.IsInf(x, 0) || math.IsNaN(x) {
+			return vb, false
+		}
+		vb[i] = x
+	}
+	return vb, vb[2] > 0 && vb[3] > 0
+}
+
+// svgRoot reads tokens up to the root element of an SVG document.
+func svgRoot(r io.Reader) (xml.StartElement, error) {
+	d := xml.NewDecoder(io.LimitReader(r, svgMaxProlog))
+	// Only ASCII attribute names and values matter.
+	d.CharsetReader = func(_ string, r io.Reader) (io.Reader, error) { return r, nil }
+	for {
+		t, err := d.Token()
+		if err != nil {
+			if err == io.EOF {
+				err = FormatError("missing SVG root element")
+			}
+			return xml.StartElement{}, err
+		}
+		if se, ok := t.(xml.StartElement); ok {
+			if se.Name.Local != "svg" {
+				return xml.StartElement{}, FormatError("root element is not svg")
+			}
+			return se, nil
+		}
+	}
+}
+
+// parseSVG resolves the intrinsic size of an SVG document.
+func parseSVG(r io.Reader) (SVGInfo, error) {
+	root, err := svgRoot(r)
+	if err != nil {
+		return SVGInfo{}, err
+	}
+	var (
+		svg         SVGInfo
+		w, h        float64
+		hasW, hasH  bool
+		haveViewBox bool
+	)
+	for _, a := range root.Attr {
+		if a.Name.Space != "" {
+			continue
+		}
+		switch a.Name.Local {
+		case "width":
+			w, hasW = parseSVGLength(a.Value)
+		case "height":
+			h, hasH = parseSVGLength(a.Value)
+		case "viewBox":
+			svg.ViewBox, haveViewBox = parseViewBox(a.Value)
+			if !haveViewBox {
+				svg.ViewBox = [4]float64{}
+			}
+		}
+	}
+	switch {
+	case hasW && hasH:
+		svg.Source = SVGSizeExplicit
+	case hasW && haveViewBox:
+		h = w * svg.ViewBox[3] / svg.ViewBox[2]
+		svg.Source = SVGSizeExplicit
+	case hasH && haveViewBox:
+		w = h * svg.ViewBox[2] / svg.ViewBox[3]
+		svg.Source = SVGSizeExplicit
+	case haveViewBox:
+		w, h = svg.ViewBox[2], svg.ViewBox[3]
+		svg.Source = SVGSizeViewBox
+	default:
+		return svg, nil
+	}
+	if w > math.MaxInt32 || h > math.MaxInt32 {
+		return SVGInfo{}, UnsupportedError("SVG too large")
+	}
+	svg.Size = Size{int(math.Round(w)), int(math.Round(h))}
+	return svg, nil
+}
+
+// decodesvg returns the intrinsic size of an SVG image, which must have
+// one.
+func decodesvg(r io.Reader) (Info, error) {
+	svg, err := parseSVG(r)
+	if err != nil {
+		return Info{}, err
+	}
+	if svg.Source == SVGSizeUnknown {
+		return Info{}, UnsupportedError("SVG without intrinsic size")
+	}
+	return Info{Size: svg.Size, Frames: 1}, nil
+}
+
+func decodesvgz(r io.Reader) (Info, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return Info{}, err
+	}
+	return decodesvg(zr)
+}
+
+// DecodeSVG resolves the intrinsic size of an SVG or SVGZ image. Unlike
+// DecodeSize, it does not fail on an image without one, but reports its
+// Source as SVGSizeUnknown. It does not detect the format of r, so no
+// Decoder restricts it; Decoder.DecodeSVG does.
+func DecodeSVG(r io.Reader) (SVGInfo, error) {
+	br := bufio.NewReader(r)
+	if b, _ := br.Peek(len(svgzHeader)); string(b) == svgzHeader {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return SVGInfo{}, err
+		}
+		return parseSVG(zr)
+	}
+	return parseSVG(br)
+}
+
+// DecodeSVG is like the DecodeSVG function, but only reads the images that
+// d detects as SVG or SVGZ and allows. The string returned is the format
+// name.
+func (d *Decoder) DecodeSVG(r io.Reader) (SVGInfo, string, error) {
+	rr, f, err := d.detect(r)
+	if err != nil {
+		return SVGInfo{}, f.name, err
+	}
+	if f.name != "svg" && f.name != "svgz" {
+		return SVGInfo{}, f.name, UnsupportedError("SVG size of " + f.name)
+	}
+	svg, err := DecodeSVG(rr)
+	return svg, f.name, err
+}
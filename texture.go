@@ -0,0 +1,65 @@
+package imgsz
+
+import "io"
+
+// A Texture describes the layout of a GPU texture container.
+type Texture struct {
+	// Size is the size of the base mip level.
+	Size
+	// Depth is the depth of a volume texture, and 1 for other textures.
+	Depth int
+	// MipLevels is the number of mip levels stored, at least 1.
+	MipLevels int
+	// Layers is the number of elements of a texture array, and 1 for other
+	// textures. The six faces of a cubemap count as one element.
+	Layers int
+	// Faces is 6 for a cubemap, or fewer for a DDS cubemap missing some of
+	// its faces, and 1 for other textures.
+	Faces int
+	// FourCC is the four-character code of the pixel format of a DDS file,
+	// such as "DXT1", or "DX10" when DXGIFormat holds it. Direct3D formats
+	// stored there as numbers are formatted in decimal. It is empty for
+	// uncompressed DDS files described by bit masks.
+	FourCC string
+	// DXGIFormat is the DXGI_FORMAT of a DDS file with a DX10 header.
+	DXGIFormat int
+	// GLInternalFormat is the OpenGL internal format of a KTX file.
+	GLInternalFormat int
+	// VkFormat is the VkFormat of a KTX2 file, 0 when its data format
+	// descriptor alone describes the texels.
+	VkFormat int
+}
+
+// textureInfo adapts a texture decoder to DecodeInfo.
+func textureInfo(decode func(io.Reader) (Texture, Info, error)) func(io.Reader) (Info, error) {
+	return func(r io.Reader) (Info, error) {
+		_, info, err := decode(r)
+		return info, err
+	}
+}
+
+// DecodeTexture reads the header of a DDS, KTX or KTX2 texture. The string
+// returned is the format name.
+func DecodeTexture(r io.Reader) (Texture, string, error) {
+	return defaultDecoder.DecodeTexture(r)
+}
+
+// DecodeTexture is like the DecodeTexture function, for the formats of d.
+func (d *Decoder) DecodeTexture(r io.Reader) (Texture, string, error) {
+	rr, f, err := d.detect(r)
+	if err != nil {
+		return Texture{}, f.name, err
+	}
+	var tex Texture
+	switch f.name {
+	case "dds":
+		tex, _, err = decodeDDS(rr)
+	case "ktx":
+		tex, _, err = decodeKTX(rr)
+	case "ktx2":
+		tex, _, err = decodeKTX2(rr)
+	default:
+		return Texture{}, f.name, UnsupportedError("texture layout of " + f.name)
+	}
+	return tex, f.name, err
+}
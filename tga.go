@@ -0,0 +1,119 @@
+// TGA files, described in the Truevision TGA File Format Specification 2.0,
+// start with an 18-byte header but no signature. TGA 2.0 files end with a
+// footer that holds one, which a stream cannot be checked for up front, so
+// the header fields are checked for consistency instead.
+
+package imgsz
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+const tgaHeaderLen = 18
+
+// TGA image types. Types 9 to 11 are the run-length encoded variants of
+// types 1 to 3.
+const (
+	tgaColorMapped    = 1
+	tgaTrueColor      = 2
+	tgaGray           = 3
+	tgaRLEColorMapped = 9
+	tgaRLETrueColor   = 10
+	tgaRLEGray        = 11
+)
+
+// tgaValidate reports whether b starts with a plausible TGA header.
+func tgaValidate(b []byte) bool {
+	if len(b) < tgaHeaderLen {
+		return false
+	}
+	cmapType, imageType := b[1], b[2]
+	cmapLen, cmapBits := binary.LittleEndian.Uint16(b[5:7]), b[7]
+	width, height := binary.LittleEndian.Uint16(b[12:14]), binary.LittleEndian.Uint16(b[14:16])
+	bpp, desc := b[16], b[17]
+	if width == 0 || height == 0 || desc&0xc0 != 0 {
+		return false
+	}
+	switch cmapType {
+	case 0:
+		// Writers leave the color map fields zeroed when there is none,
+		// which rules out most streams of other formats.
+		if cmapLen != 0 || cmapBits != 0 {
+			return false
+		}
+	case 1:
+		if cmapLen == 0 {
+			return false
+		}
+		switch cmapBits {
+		case 15, 16, 24, 32:
+		default:
+			return false
+		}
+	default:
+		return false
+	}
+	alphaBits := desc & 0x0f
+	switch imageType {
+	case tgaColorMapped, tgaRLEColorMapped:
+		return cmapType == 1 && (bpp == 8 || bpp == 16) && alphaBits == 0
+	case tgaTrueColor, tgaRLETrueColor:
+		switch bpp {
+		case 15, 16:
+			return alphaBits <= 1
+		case 24:
+			return alphaBits == 0
+		case 32:
+			return alphaBits == 0 || alphaBits == 8
+		}
+	case tgaGray, tgaRLEGray:
+		return (bpp == 8 || bpp == 16) && alphaBits <= bpp-8
+	}
+	return false
+}
+
+// decodetga returns the dimensions and pixel format of a TGA image from its
+// header.
+func decodetga(r io.Reader) (Info, error) {
+	var b [tgaHeaderLen]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return Info{}, err
+	}
+	if !tgaValidate(b[:]) {
+		return Info{}, FormatError("bad TGA header")
+	}
+	info := Info{
+		Size: Size{
+			Width:  int(binary.LittleEndian.Uint16(b[12:14])),
+			Height: int(binary.LittleEndian.Uint16(b[14:16])),
+		},
+		SampleFormat: SampleUint,
+		Frames:       1,
+	}
+	bpp, alphaBits := int(b[16]), int(b[17]&0x0f)
+	switch b[2] {
+	case tgaColorMapped, tgaRLEColorMapped:
+		info.BitDepth, info.Channels, info.ColorModel = bpp, 1, ColorPalette
+		// Only the entries of the color map may have an alpha channel.
+		info.HasAlpha = b[7] == 32
+	case tgaTrueColor, tgaRLETrueColor:
+		info.ColorModel, info.Channels = ColorRGB, 3
+		info.BitDepth = 8
+		if bpp < 24 {
+			info.BitDepth = 5
+		}
+		if alphaBits > 0 {
+			info.Channels, info.HasAlpha = 4, true
+		}
+	case tgaGray, tgaRLEGray:
+		info.ColorModel, info.Channels, info.BitDepth = ColorGray, 1, 8
+		if alphaBits > 0 {
+			info.Channels, info.HasAlpha = 2, true
+		}
+	}
+	return info, nil
+}
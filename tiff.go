@@ -16,6 +16,10 @@ import (
 
 const maxChunkSize = 10 << 20 // 10M
 
+// maxOffset bounds the offsets read from a file, far beyond those of any
+// real TIFF, so that a bogus one is not buffered up to from an io.Reader.
+const maxOffset = 1 << 40
+
 // safeReadAt is a verbatim copy of internal/saferio.ReadDataAt from the
 // standard library, which is used to read data from a reader using a length
 // provided by untrusted data, without allocating the entire slice ahead of time
@@ -63,6 +67,7 @@ func safeReadAt(r io.ReaderAt, n uint64, off int64) ([]byte, error) {
 type tiffdecoder struct {
 	r         io.ReaderAt
 	byteOrder binary.ByteOrder
+	big       bool // BigTIFF, with 8-byte offsets and counts.
 	config    Size
 	features  map[int][]uint
 	palette   []color.Color
@@ -78,29 +83,61 @@ func (d *tiffdecoder) firstVal(tag int) uint {
 	return f[0]
 }
 
-// ifdUint decodes the IFD entry in p, which must be of the Byte, Short
-// or Long type, and returns the decoded uint values.
-func (d *tiffdecoder) ifdUint(p []byte) (u []uint, err error) {
-	var raw []byte
-	if len(p) < ifdLen {
-		return nil, FormatError("bad IFD entry")
+// entryLen returns the length of an IFD entry in bytes.
+func (d *tiffdecoder) entryLen() int {
+	if d.big {
+		return bigIFDLen
+	}
+	return ifdLen
+}
+
+// offset decodes an offset or a count, which are 8 bytes long in BigTIFF
+// and 4 bytes long otherwise.
+func (d *tiffdecoder) offset(b []byte) uint64 {
+	if d.big {
+		return d.byteOrder.Uint64(b)
+	}
+	return uint64(d.byteOrder.Uint32(b))
+}
+
+// ifdData returns the data type, the count and the raw data of the IFD
+// entry in p.
+func (d *tiffdecoder) ifdData(p []byte) (datatype uint16, count uint64, raw []byte, err error) {
+	n := d.entryLen()
+	if len(p) < n {
+		return 0, 0, nil, FormatError("bad IFD entry")
 	}
 
-	datatype := d.byteOrder.Uint16(p[2:4])
-	if dt := int(datatype); dt <= 0 || dt >= len(lengths) {
-		return nil, UnsupportedError("IFD entry datatype")
+	datatype = d.byteOrder.Uint16(p[2:4])
+	if dt := int(datatype); dt <= 0 || dt >= len(lengths) || lengths[dt] == 0 {
+		return 0, 0, nil, UnsupportedError("IFD entry datatype")
 	}
 
-	count := d.byteOrder.Uint32(p[4:8])
-	if count > math.MaxInt32/lengths[datatype] {
-		return nil, FormatError("IFD data too large")
+	// The count is followed by the value itself, if it fits, or by a
+	// pointer to it.
+	half := (n - 4) / 2
+	count = d.offset(p[4 : 4+half])
+	value := p[4+half : n]
+	if count > math.MaxInt32/uint64(lengths[datatype]) {
+		return 0, 0, nil, FormatError("IFD data too large")
 	}
-	if datalen := lengths[datatype] * count; datalen > 4 {
+	if datalen := uint64(lengths[datatype]) * count; datalen > uint64(len(value)) {
 		// The IFD contains a pointer to the real value.
-		raw, err = safeReadAt(d.r, uint64(datalen), int64(d.byteOrder.Uint32(p[8:12])))
+		off := d.offset(value)
+		if off > maxOffset {
+			return 0, 0, nil, FormatError("bad IFD data offset")
+		}
+		raw, err = safeReadAt(d.r, datalen, int64(off))
 	} else {
-		raw = p[8 : 8+datalen]
+		raw = value[:datalen]
 	}
+	return datatype, count, raw, err
+}
+
+// ifdUint decodes the IFD entry in p, which must be of the Byte, Short,
+// Long, IFD, Long8 or IFD8 type, and returns the decoded uint values.
+func (d *tiffdecoder) ifdUint(p []byte) (u []uint, err error) {
+	datatype, count, raw, err := d.ifdData(p)
 	if err != nil {
 		return nil, err
 	}
@@ -108,17 +145,21 @@ func (d *tiffdecoder) ifdUint(p []byte) (u []uint, err error) {
 	u = make([]uint, count)
 	switch datatype {
 	case dtByte:
-		for i := uint32(0); i < count; i++ {
+		for i := uint64(0); i < count; i++ {
 			u[i] = uint(raw[i])
 		}
 	case dtShort:
-		for i := uint32(0); i < count; i++ {
+		for i := uint64(0); i < count; i++ {
 			u[i] = uint(d.byteOrder.Uint16(raw[2*i : 2*(i+1)]))
 		}
-	case dtLong:
-		for i := uint32(0); i < count; i++ {
+	case dtLong, dtIFD:
+		for i := uint64(0); i < count; i++ {
 			u[i] = uint(d.byteOrder.Uint32(raw[4*i : 4*(i+1)]))
 		}
+	case dtLong8, dtIFD8:
+		for i := uint64(0); i < count; i++ {
+			u[i] = uint(d.byteOrder.Uint64(raw[8*i : 8*(i+1)]))
+		}
 	default:
 		return nil, UnsupportedError("data type")
 	}
@@ -131,7 +172,11 @@ func (d *tiffdecoder) ifdUint(p []byte) (u []uint, err error) {
 func (d *tiffdecoder) parseIFD(p []byte) (int, error) {
 	tag := d.byteOrder.Uint16(p[0:2])
 	switch tag {
-	case tBitsPerSample,
+	case tNewSubfileType,
+		tSubfileType,
+		tBitsPerSample,
+		tSamplesPerPixel,
+		tSampleFormat,
 		tExtraSamples,
 		tPhotometricInterpretation,
 		tCompression,
@@ -145,6 +190,9 @@ func (d *tiffdecoder) parseIFD(p []byte) (int, error) {
 		tTileByteCounts,
 		tImageLength,
 		tImageWidth,
+		tOrientation,
+		tSubIFDs,
+		tDNGVersion,
 		tFillOrder,
 		tT4Options,
 		tT6Options:
@@ -171,85 +219,299 @@ func (d *tiffdecoder) parseIFD(p []byte) (int, error) {
 				0xffff,
 			}
 		}
-	case tSampleFormat:
-		// Page 27 of the spec: If the SampleFormat is present and
-		// the value is not 1 [= unsigned integer data], a Baseline
-		// TIFF reader that cannot handle the SampleFormat value
-		// must terminate the import process gracefully.
-		val, err := d.ifdUint(p)
-		if err != nil {
-			return 0, err
-		}
-		for _, v := range val {
-			if v != 1 {
-				return 0, UnsupportedError("sample format")
-			}
-		}
 	}
 	return int(tag), nil
 }
 
-func newtiffDecoder(r io.Reader) (*tiffdecoder, error) {
-	d := &tiffdecoder{
-		r:        newReaderAt(r),
-		features: make(map[int][]uint),
-	}
-
-	p := make([]byte, 8)
-	if _, err := d.r.ReadAt(p, 0); err != nil {
+// readHeader reads the byte order and the version from the file header and
+// returns the offset of the first IFD.
+func (d *tiffdecoder) readHeader() (int64, error) {
+	p := make([]byte, 16)
+	if _, err := d.r.ReadAt(p[:8], 0); err != nil {
 		if err == io.EOF {
 			err = io.ErrUnexpectedEOF
 		}
-		return nil, err
+		return 0, err
 	}
-	switch string(p[0:4]) {
-	case leHeader:
+	switch string(p[0:2]) {
+	case "II":
 		d.byteOrder = binary.LittleEndian
-	case beHeader:
+	case "MM":
 		d.byteOrder = binary.BigEndian
 	default:
-		return nil, FormatError("malformed header")
+		return 0, FormatError("malformed header")
+	}
+	switch d.byteOrder.Uint16(p[2:4]) {
+	case 42, orfVersion, orfVersionS, rw2Version:
+		// ORF and RW2 files only differ from TIFF in their version.
+		return int64(d.byteOrder.Uint32(p[4:8])), nil
+	case 43:
+	default:
+		return 0, FormatError("malformed header")
 	}
 
-	ifdOffset := int64(d.byteOrder.Uint32(p[4:8]))
+	// A BigTIFF header goes on with the byte size of offsets, which is
+	// always 8, a zero and the 8-byte offset of the first IFD.
+	if d.byteOrder.Uint16(p[4:6]) != 8 || d.byteOrder.Uint16(p[6:8]) != 0 {
+		return 0, FormatError("malformed BigTIFF header")
+	}
+	d.big = true
+	if _, err := d.r.ReadAt(p[8:16], 8); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, err
+	}
+	off := d.byteOrder.Uint64(p[8:16])
+	if off > maxOffset {
+		return 0, FormatError("bad IFD offset")
+	}
+	return int64(off), nil
+}
 
-	// The first two bytes contain the number of entries (12 bytes each).
-	if _, err := d.r.ReadAt(p[0:2], ifdOffset); err != nil {
-		return nil, err
+// ifdEntries reads the entries of the IFD at offset off. It also returns the
+// offset of the next IFD, which is 0 for the last one, if the file ends
+// without it, or if it is out of bounds.
+func (d *tiffdecoder) ifdEntries(off int64) (p []byte, next int64, err error) {
+	if off < 0 || off > maxOffset {
+		return nil, 0, FormatError("bad IFD offset")
+	}
+	// The entries are preceded by their number, and followed by the offset
+	// of the next IFD, both of which take 8 bytes in BigTIFF and 2 and 4
+	// bytes otherwise.
+	countLen, offsetLen := 2, 4
+	if d.big {
+		countLen, offsetLen = 8, 8
+	}
+	b := make([]byte, 8)
+	if _, err := d.r.ReadAt(b[:countLen], off); err != nil {
+		return nil, 0, err
+	}
+	numItems := uint64(d.byteOrder.Uint16(b))
+	if d.big {
+		numItems = d.byteOrder.Uint64(b)
+	}
+	if numItems > math.MaxInt32/uint64(d.entryLen()) {
+		return nil, 0, FormatError("IFD too large")
 	}
-	numItems := int(d.byteOrder.Uint16(p[0:2]))
 
 	// All IFD entries are read in one chunk.
-	var err error
-	p, err = safeReadAt(d.r, uint64(ifdLen*numItems), ifdOffset+2)
+	p, err = safeReadAt(d.r, numItems*uint64(d.entryLen()), off+int64(countLen))
 	if err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+	if _, err := d.r.ReadAt(b[:offsetLen], off+int64(countLen+len(p))); err == nil {
+		if o := d.offset(b); o <= maxOffset {
+			next = int64(o)
+		}
+	}
+	return p, next, nil
+}
+
+// readIFD reads the IFD at offset off into d, replacing the features of the
+// previous one, and returns the offset of the next IFD, or 0 if it is the
+// last.
+func (d *tiffdecoder) readIFD(off int64) (int64, error) {
+	d.features = make(map[int][]uint)
+	d.palette = nil
+
+	p, next, err := d.ifdEntries(off)
+	if err != nil {
+		return 0, err
 	}
 
+	n := d.entryLen()
 	prevTag := -1
-	for i := 0; i < len(p); i += ifdLen {
-		tag, err := d.parseIFD(p[i : i+ifdLen])
+	for i := 0; i < len(p); i += n {
+		tag, err := d.parseIFD(p[i : i+n])
 		if err != nil {
-			return nil, err
+			return 0, err
 		}
 		if tag <= prevTag {
-			return nil, FormatError("tags are not sorted in ascending order")
+			return 0, FormatError("tags are not sorted in ascending order")
 		}
 		prevTag = tag
 	}
 
 	d.config.Width = int(d.firstVal(tImageWidth))
 	d.config.Height = int(d.firstVal(tImageLength))
+	return next, nil
+}
 
-	return d, nil
+// newtiffDecoder reads the first IFD of r, and returns its offset.
+func newtiffDecoder(r io.Reader) (*tiffdecoder, int64, error) {
+	d := &tiffdecoder{
+		r: newReaderAt(r),
+	}
+
+	ifdOffset, err := d.readHeader()
+	if err != nil {
+		return nil, 0, err
+	}
+	if _, err := d.readIFD(ifdOffset); err != nil {
+		return nil, 0, err
+	}
+	return d, ifdOffset, nil
+}
+
+// orientation returns the Orientation tag, or 0 if it is absent or out of
+// range.
+func (d *tiffdecoder) orientation() int {
+	o := d.firstVal(tOrientation)
+	if o < 1 || o > 8 {
+		return 0
+	}
+	return int(o)
+}
+
+func (d *tiffdecoder) info() Info {
+	info := Info{
+		Size:         d.config,
+		BitDepth:     int(d.firstVal(tBitsPerSample)),
+		Channels:     int(d.firstVal(tSamplesPerPixel)),
+		SampleFormat: SampleUint,
+		Orientation:  d.orientation(),
+	}
+	if info.BitDepth == 0 {
+		info.BitDepth = 1
+	}
+	if info.Channels == 0 {
+		info.Channels = 1
+	}
+	// Only a decoder of the pixels has to care that the samples are not
+	// unsigned integers. The first sample stands for all of them.
+	if sf := d.features[tSampleFormat]; len(sf) > 0 {
+		switch sf[0] {
+		case sfUint:
+		case sfInt:
+			info.SampleFormat = SampleInt
+		case sfFloat:
+			info.SampleFormat = SampleFloat
+		default:
+			info.SampleFormat = SampleUnknown
+		}
+	}
+	if pi := d.features[tPhotometricInterpretation]; len(pi) > 0 {
+		switch pi[0] {
+		case pWhiteIsZero, pBlackIsZero, pTransMask:
+			info.ColorModel = ColorGray
+		case pRGB:
+			info.ColorModel = ColorRGB
+		case pPaletted:
+			info.ColorModel = ColorPalette
+		case pCMYK:
+			info.ColorModel = ColorCMYK
+		case pYCbCr:
+			info.ColorModel = ColorYCbCr
+		case pCIELab:
+			info.ColorModel = ColorLab
+		}
+	}
+	// Extra samples of 1 and 2 are associated and unassociated alpha.
+	for _, v := range d.features[tExtraSamples] {
+		if v == 1 || v == 2 {
+			info.HasAlpha = true
+		}
+	}
+	return info
 }
 
 // decodetiff returns the color model and dimensions of a TIFF image without
 // decoding the entire image.
-func decodetiff(r io.Reader) (Size, error) {
-	d, err := newtiffDecoder(r)
+func decodetiff(r io.Reader) (Info, error) {
+	d, off, err := newtiffDecoder(r)
+	if err != nil {
+		return Info{}, err
+	}
+	info := d.info()
+	dng := d.features[tDNGVersion] != nil
+	if d.firstVal(tNewSubfileType)&1 == 0 {
+		if dng {
+			info.Size = d.cropDNG(off, info.Size)
+		}
+		return info, nil
+	}
+	// RAW files such as DNG and NEF start with a thumbnail, and keep the
+	// full-resolution image in a SubIFD. The orientation of the thumbnail
+	// applies to it too.
+	for _, off := range d.features[tSubIFDs] {
+		if _, err := d.readIFD(int64(off)); err == nil && d.firstVal(tNewSubfileType)&1 == 0 {
+			sub := d.info()
+			sub.Orientation = info.Orientation
+			if dng {
+				sub.Size = d.cropDNG(int64(off), sub.Size)
+			}
+			return sub, nil
+		}
+	}
+	return info, nil
+}
+
+// cropDNG returns the size s of the DNG image described by the IFD at
+// offset off once cropped, as DecodeRAW reports it.
+func (d *tiffdecoder) cropDNG(off int64, s Size) Size {
+	ifd, _, err := d.exifIFD(off)
+	if err != nil {
+		return s
+	}
+	return dngCrop(ifd, s)
+}
+
+// A TIFFPage describes one IFD in the chain of a TIFF file.
+type TIFFPage struct {
+	Size
+	// SubfileType is the NewSubfileType tag. Bit 0 marks a reduced
+	// resolution version of another page, bit 1 a page of a multi-page
+	// document and bit 2 a transparency mask.
+	SubfileType uint
+	// Reduced reports a reduced resolution version of another page, such
+	// as a level of a pyramidal TIFF or a thumbnail.
+	Reduced bool
+}
+
+// DecodeTIFFPages returns the size of every page of a TIFF file, following
+// the chain of IFDs. On error, it also returns the pages read so far. It
+// does not detect the format of r, so no Decoder restricts it;
+// Decoder.DecodeTIFFPages does.
+func DecodeTIFFPages(r io.Reader) ([]TIFFPage, error) {
+	d := &tiffdecoder{
+		r: newReaderAt(r),
+	}
+	off, err := d.readHeader()
+	if err != nil {
+		return nil, err
+	}
+	var pages []TIFFPage
+	seen := make(map[int64]bool)
+	for off != 0 {
+		if seen[off] {
+			return pages, FormatError("IFD chain loops")
+		}
+		seen[off] = true
+		if off, err = d.readIFD(off); err != nil {
+			return pages, err
+		}
+		page := TIFFPage{Size: d.config, SubfileType: d.firstVal(tNewSubfileType)}
+		// The old SubfileType tag uses 2 for reduced resolution images.
+		page.Reduced = page.SubfileType&1 != 0 || d.firstVal(tSubfileType) == 2
+		pages = append(pages, page)
+	}
+	return pages, nil
+}
+
+// DecodeTIFFPages is like the DecodeTIFFPages function, but only reads the
+// images that d detects as TIFF, or as a TIFF based RAW format, and allows.
+// The string returned is the format name.
+func (d *Decoder) DecodeTIFFPages(r io.Reader) ([]TIFFPage, string, error) {
+	rr, f, err := d.detect(r)
 	if err != nil {
-		return Size{}, err
+		return nil, f.name, err
+	}
+	switch f.name {
+	case "tiff", "orf", "rw2":
+	default:
+		return nil, f.name, UnsupportedError("TIFF pages of " + f.name)
 	}
-	return d.config, nil
+	pages, err := DecodeTIFFPages(rr)
+	return pages, f.name, err
 }
@@ -13,23 +13,26 @@ type buffer struct {
 }
 
 // fill reads data from b.r until the buffer contains at least end bytes.
+// The buffer grows with the data read, rather than to end up front, so that
+// an end far past the end of the data does not allocate up to it.
 func (b *buffer) fill(end int) error {
-	m := len(b.buf)
-	if end > m {
-		if end > cap(b.buf) {
-			newcap := 1024
-			for newcap < end {
-				newcap *= 2
+	for m := len(b.buf); m < end; m = len(b.buf) {
+		if m == cap(b.buf) {
+			newcap := 2 * m
+			if newcap < 1024 {
+				newcap = 1024
 			}
-			newbuf := make([]byte, end, newcap)
+			newbuf := make([]byte, m, newcap)
 			copy(newbuf, b.buf)
 			b.buf = newbuf
-		} else {
-			b.buf = b.buf[:end]
 		}
-		if n, err := io.ReadFull(b.r, b.buf[m:end]); err != nil {
-			end = m + n
-			b.buf = b.buf[:end]
+		n := cap(b.buf)
+		if n > end {
+			n = end
+		}
+		k, err := io.ReadFull(b.r, b.buf[m:n])
+		b.buf = b.buf[:m+k]
+		if err != nil {
 			return err
 		}
 	}
@@ -39,18 +42,26 @@ func (b *buffer) fill(end int) error {
 func (b *buffer) ReadAt(p []byte, off int64) (int, error) {
 	o := int(off)
 	end := o + len(p)
-	if int64(end) != off+int64(len(p)) {
+	if off < 0 || int64(end) != off+int64(len(p)) {
 		return 0, io.ErrUnexpectedEOF
 	}
 
-	err := b.fill(end)
-	return copy(p, b.buf[o:end]), err
+	if err := b.fill(end); err != nil {
+		if o >= len(b.buf) {
+			return 0, err
+		}
+		return copy(p, b.buf[o:]), err
+	}
+	return copy(p, b.buf[o:end]), nil
 }
 
 // Slice returns a slice of the underlying buffer. The slice contains
 // n bytes starting at offset off.
 func (b *buffer) Slice(off, n int) ([]byte, error) {
 	end := off + n
+	if off < 0 || n < 0 || end < off {
+		return nil, io.ErrUnexpectedEOF
+	}
 	if err := b.fill(end); err != nil {
 		return nil, err
 	}
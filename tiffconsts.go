@@ -22,26 +22,69 @@ const (
 	ifdLen = 12 // Length of an IFD entry in bytes.
 )
 
-// Data types (p. 14-16 of the spec).
+// BigTIFF files have 8-byte offsets and counts, and thus 20-byte IFD
+// entries, as described at https://www.awaresystems.be/imaging/tiff/bigtiff.html.
 const (
-	dtByte     = 1
-	dtASCII    = 2
-	dtShort    = 3
-	dtLong     = 4
-	dtRational = 5
+	leBigHeader = "II\x2B\x00" // Header for little-endian BigTIFF files.
+	beBigHeader = "MM\x00\x2B" // Header for big-endian BigTIFF files.
+
+	bigIFDLen = 20 // Length of a BigTIFF IFD entry in bytes.
+)
+
+// Data types (p. 14-16 of the spec, and p. 20 of the TIFF Supplement 1
+// for IFD).
+const (
+	dtByte      = 1
+	dtASCII     = 2
+	dtShort     = 3
+	dtLong      = 4
+	dtRational  = 5
+	dtSByte     = 6
+	dtUndefined = 7
+	dtSShort    = 8
+	dtSLong     = 9
+	dtSRational = 10
+	dtFloat     = 11
+	dtDouble    = 12
+	dtIFD       = 13
+	dtLong8     = 16 // BigTIFF only.
+	dtSLong8    = 17 // BigTIFF only.
+	dtIFD8      = 18 // BigTIFF only.
 )
 
-// The length of one instance of each data type in bytes.
-var lengths = [...]uint32{0, 1, 1, 2, 4, 8}
+// The length of one instance of each data type in bytes. Unassigned data
+// types have a length of 0.
+var lengths = [...]uint32{0, 1, 1, 2, 4, 8, 1, 1, 2, 4, 8, 4, 8, 4, 0, 0, 8, 8, 8}
+
+// Photometric interpretation values (see p. 37 of the spec).
+const (
+	pWhiteIsZero = 0
+	pBlackIsZero = 1
+	pRGB         = 2
+	pPaletted    = 3
+	pTransMask   = 4 // transparency mask
+	pCMYK        = 5
+	pYCbCr       = 6
+	pCIELab      = 8
+	pCFA         = 32803 // color filter array, in RAW files
+	pLinearRaw   = 34892 // demosaiced raw data, in DNG files
+)
 
 // Tags (see p. 28-41 of the spec).
 const (
+	tNewSubfileType = 254
+	tSubfileType    = 255
+
 	tImageWidth                = 256
 	tImageLength               = 257
 	tBitsPerSample             = 258
 	tCompression               = 259
 	tPhotometricInterpretation = 262
 
+	tMake        = 271
+	tModel       = 272
+	tOrientation = 274
+
 	tFillOrder = 266
 
 	tStripOffsets    = 273
@@ -57,8 +100,51 @@ const (
 	tTileOffsets    = 324
 	tTileByteCounts = 325
 
+	tDateTime = 306
+
 	tPredictor    = 317
 	tColorMap     = 320
+	tSubIFDs      = 330
 	tExtraSamples = 338
 	tSampleFormat = 339
+
+	tJPEGInterchangeFormat       = 513
+	tJPEGInterchangeFormatLength = 514
+)
+
+// Compression types used by embedded JPEG data.
+const (
+	cJPEGOld = 6
+	cJPEG    = 7
+)
+
+// DNG tags (see the DNG 1.6 specification).
+const (
+	tDNGVersion      = 50706
+	tDefaultCropSize = 50720
+	tActiveArea      = 50829
+)
+
+// EXIF tags (see the Exif 2.32 specification).
+const (
+	tExifIFD = 34665
+	tGPSIFD  = 34853
+
+	tDateTimeOriginal   = 36867
+	tOffsetTimeOriginal = 36881
+)
+
+// Sample format values (see p. 80 of the TIFF 6.0 spec).
+const (
+	sfUint  = 1
+	sfInt   = 2
+	sfFloat = 3
+)
+
+// GPS tags, which live in the GPS IFD.
+const (
+	gpsLatitudeRef  = 1
+	gpsLatitude     = 2
+	gpsLongitudeRef = 3
+	gpsLongitude    = 4
 )
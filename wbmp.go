@@ -0,0 +1,83 @@
+// WBMP is the monochrome bitmap format of WAP, described in the WAP-237
+// Wireless Application Environment specification. Only type 0 images exist.
+// Their header is a type field, a fixed header byte, then the width and the
+// height as multi-byte integers, which hold 7 bits per byte, most
+// significant first, with the high bit set on every byte but the last.
+
+package imgsz
+
+import "io"
+
+const (
+	wbmpMaxIntLen = 4
+	wbmpMaxSize   = 1 << 12 // Far beyond the screens that WBMP was made for.
+)
+
+// wbmpInt parses a multi-byte integer at the start of b, and returns it
+// with its length, or a length of 0 if b holds none.
+func wbmpInt(b []byte) (v, n int) {
+	for n < len(b) && n < wbmpMaxIntLen {
+		c := b[n]
+		// A leading zero group would make the encoding ambiguous.
+		if n == 0 && c == 0x80 {
+			return 0, 0
+		}
+		v = v<<7 | int(c&0x7f)
+		n++
+		if c&0x80 == 0 {
+			return v, n
+		}
+	}
+	return 0, 0
+}
+
+// wbmpSniff reports whether b starts with a plausible type 0 WBMP header,
+// followed by no more bytes than the pixel data takes, whose rows are
+// padded to whole bytes. Its first two bytes are zero, so it is only tried
+// after the formats that have a signature.
+func wbmpSniff(b []byte) bool {
+	size, n, err := parseWBMP(b)
+	return err == nil && len(b)-n <= (size.Width+7)/8*size.Height
+}
+
+// parseWBMP parses the header at the start of b, and returns the size that
+// it gives and its length.
+func parseWBMP(b []byte) (Size, int, error) {
+	if len(b) < 4 || b[0] != 0 || b[1] != 0 {
+		return Size{}, 0, FormatError("bad WBMP header")
+	}
+	w, n := wbmpInt(b[2:])
+	if n == 0 || w == 0 || w > wbmpMaxSize {
+		return Size{}, 0, FormatError("bad WBMP width")
+	}
+	h, m := wbmpInt(b[2+n:])
+	if m == 0 || h == 0 || h > wbmpMaxSize {
+		return Size{}, 0, FormatError("bad WBMP height")
+	}
+	return Size{w, h}, 2 + n + m, nil
+}
+
+// decodewbmp returns the dimensions of a WBMP image.
+func decodewbmp(r io.Reader) (Info, error) {
+	// A small image may have less pixel data than the longest header.
+	var b [2 + 2*wbmpMaxIntLen]byte
+	n, err := io.ReadFull(r, b[:])
+	if err != nil && err != io.ErrUnexpectedEOF {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return Info{}, err
+	}
+	size, _, err := parseWBMP(b[:n])
+	if err != nil {
+		return Info{}, err
+	}
+	return Info{
+		Size:         size,
+		BitDepth:     1,
+		Channels:     1,
+		SampleFormat: SampleUint,
+		ColorModel:   ColorGray,
+		Frames:       1,
+	}, nil
+}
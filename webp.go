@@ -11,6 +11,7 @@ import (
 	"image"
 	"io"
 	"math"
+	"time"
 
 	"golang.org/x/image/vp8l"
 )
@@ -22,6 +23,10 @@ type fourCC [4]byte
 
 var (
 	fccALPH = fourCC{'A', 'L', 'P', 'H'}
+	fccANIM = fourCC{'A', 'N', 'I', 'M'}
+	fccANMF = fourCC{'A', 'N', 'M', 'F'}
+	fccEXIF = fourCC{'E', 'X', 'I', 'F'}
+	fccICCP = fourCC{'I', 'C', 'C', 'P'}
 	fccVP8  = fourCC{'V', 'P', '8', ' '}
 	fccVP8L = fourCC{'V', 'P', '8', 'L'}
 	fccVP8X = fourCC{'V', 'P', '8', 'X'}
@@ -194,13 +199,13 @@ func (c *chunkReader) Read(p []byte) (int, error) {
 	return n, err
 }
 
-func decodewebp(r io.Reader) (Size, error) {
+func decodewebp(r io.Reader) (Info, error) {
 	formType, riffReader, err := newReader(r)
 	if err != nil {
-		return Size{}, err
+		return Info{}, err
 	}
 	if formType != fccWEBP {
-		return Size{}, errInvalidFormat
+		return Info{}, errInvalidFormat
 	}
 
 	var (
@@ -217,13 +222,13 @@ func decodewebp(r io.Reader) (Size, error) {
 			err = errInvalidFormat
 		}
 		if err != nil {
-			return Size{}, err
+			return Info{}, err
 		}
 
 		switch chunkID {
 		case fccALPH:
 			if !wantAlpha {
-				return Size{}, errInvalidFormat
+				return Info{}, errInvalidFormat
 			}
 			wantAlpha = false
 			// Read the Pre-processing | Filter | Compression byte.
@@ -231,37 +236,48 @@ func decodewebp(r io.Reader) (Size, error) {
 				if err == io.EOF {
 					err = errInvalidFormat
 				}
-				return Size{}, err
+				return Info{}, err
 			}
 			alpha, alphaStride, err = readAlpha(chunkData, widthMinusOne, heightMinusOne, buf[0]&0x03)
 			if err != nil {
-				return Size{}, err
+				return Info{}, err
 			}
 			unfilterAlpha(alpha, alphaStride, (buf[0]>>2)&0x03)
 
 		case fccVP8:
 			if wantAlpha || int32(chunkLen) < 0 {
-				return Size{}, errInvalidFormat
+				return Info{}, errInvalidFormat
 			}
 			w, h, err := decodeVP8FrameHeader(chunkData)
 			if err != nil {
-				return Size{}, err
+				return Info{}, err
 			}
-			return Size{w, h}, nil
+			return Info{
+				Size:       Size{w, h},
+				BitDepth:   8,
+				ColorModel: ColorYCbCr,
+				Frames:     1,
+			}, nil
 
 		case fccVP8L:
 			if wantAlpha || alpha != nil {
-				return Size{}, errInvalidFormat
+				return Info{}, errInvalidFormat
 			}
-			w, h, err := decodeVP8LHeader(chunkData)
-			return Size{int(w), int(h)}, err
+			w, h, hasAlpha, err := decodeVP8LHeader(chunkData)
+			return Info{
+				Size:       Size{int(w), int(h)},
+				BitDepth:   8,
+				ColorModel: ColorRGB,
+				HasAlpha:   hasAlpha,
+				Frames:     1,
+			}, err
 
 		case fccVP8X:
 			if chunkLen != 10 {
-				return Size{}, errInvalidFormat
+				return Info{}, errInvalidFormat
 			}
 			if _, err := io.ReadFull(chunkData, buf[:10]); err != nil {
-				return Size{}, err
+				return Info{}, err
 			}
 			const (
 				animationBit    = 1 << 1
@@ -273,16 +289,130 @@ func decodewebp(r io.Reader) (Size, error) {
 			wantAlpha = (buf[0] & alphaBit) != 0
 			widthMinusOne = uint32(buf[4]) | uint32(buf[5])<<8 | uint32(buf[6])<<16
 			heightMinusOne = uint32(buf[7]) | uint32(buf[8])<<8 | uint32(buf[9])<<16
-			if wantAlpha {
-				return Size{
+			info := Info{
+				Size: Size{
 					Width:  int(widthMinusOne) + 1,
 					Height: int(heightMinusOne) + 1,
-				}, nil
+				},
+				BitDepth: 8,
+				HasAlpha: wantAlpha,
+				Animated: buf[0]&animationBit != 0,
 			}
-			return Size{
-				Width:  int(widthMinusOne) + 1,
-				Height: int(heightMinusOne) + 1,
-			}, nil
+			if !info.Animated {
+				info.Frames = 1
+			}
+			// The EXIF chunk of an animation follows all of its frames, so
+			// only a still image is looked through for it.
+			if buf[0]&exifMetadataBit != 0 && !info.Animated {
+				if b, err := readEXIF(riffReader, true); err == nil {
+					info.Orientation = exifOrientation(b)
+				}
+			}
+			return info, nil
+		}
+	}
+}
+
+// readEXIF skips to the EXIF chunk, which follows the image data, and
+// returns its payload, or nil if there is none. If still is true, the
+// search ends at the first chunk that cannot come before the EXIF chunk of
+// a still image.
+func readEXIF(z *webpeader, still bool) ([]byte, error) {
+	for {
+		chunkID, chunkLen, chunkData, err := z.next()
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if chunkID != fccEXIF {
+			switch {
+			case !still:
+			case chunkID == fccICCP, chunkID == fccALPH, chunkID == fccVP8, chunkID == fccVP8L:
+			default:
+				return nil, nil
+			}
+			continue
+		}
+		if chunkLen > maxChunkSize {
+			return nil, UnsupportedError("EXIF chunk too large")
+		}
+		b := make([]byte, chunkLen)
+		if _, err := io.ReadFull(chunkData, b); err != nil {
+			return nil, err
+		}
+		return b, nil
+	}
+}
+
+// webpExif returns the payload of the EXIF chunk of a WebP image, or nil if
+// there is none.
+func webpExif(r io.Reader) ([]byte, error) {
+	formType, riffReader, err := newReader(r)
+	if err != nil {
+		return nil, err
+	}
+	if formType != fccWEBP {
+		return nil, errInvalidFormat
+	}
+	return readEXIF(riffReader, false)
+}
+
+// webpAnimation walks all the chunks of a WebP image, counting the ANMF
+// frames of an animation and adding up their durations.
+func webpAnimation(r io.Reader) (Animation, error) {
+	formType, riffReader, err := newReader(r)
+	if err != nil {
+		return Animation{}, err
+	}
+	if formType != fccWEBP {
+		return Animation{}, errInvalidFormat
+	}
+	var (
+		anim Animation
+		buf  [16]byte
+	)
+	for {
+		chunkID, chunkLen, chunkData, err := riffReader.next()
+		if err == io.EOF {
+			if !anim.Animated {
+				return Animation{}, errInvalidFormat
+			}
+			return anim, nil
+		}
+		if err != nil {
+			return Animation{}, err
+		}
+		switch chunkID {
+		case fccVP8, fccVP8L:
+			// Image data outside of an ANMF chunk makes a still image.
+			if !anim.Animated {
+				return Animation{Frames: 1, LoopCount: 1}, nil
+			}
+		case fccANIM:
+			// The background color is followed by the loop count.
+			if chunkLen != 6 {
+				return Animation{}, errInvalidFormat
+			}
+			if _, err := io.ReadFull(chunkData, buf[:6]); err != nil {
+				return Animation{}, err
+			}
+			anim.Animated = true
+			anim.LoopCount = int(buf[4]) | int(buf[5])<<8
+		case fccANMF:
+			// The frame's position and size are followed by its duration
+			// in milliseconds.
+			if chunkLen < 16 {
+				return Animation{}, errInvalidFormat
+			}
+			if _, err := io.ReadFull(chunkData, buf[:16]); err != nil {
+				return Animation{}, err
+			}
+			anim.Animated = true
+			anim.Frames++
+			ms := uint32(buf[12]) | uint32(buf[13])<<8 | uint32(buf[14])<<16
+			anim.Duration += time.Duration(ms) * time.Millisecond
 		}
 	}
 }
@@ -336,7 +466,7 @@ func (d *vp8ldecoder) read(n uint32) (uint32, error) {
 	return u, nil
 }
 
-func decodeVP8LHeader(r io.Reader) (w int32, h int32, err error) {
+func decodeVP8LHeader(r io.Reader) (w int32, h int32, hasAlpha bool, err error) {
 	rr, ok := r.(io.ByteReader)
 	if !ok {
 		rr = bufio.NewReader(r)
@@ -344,33 +474,33 @@ func decodeVP8LHeader(r io.Reader) (w int32, h int32, err error) {
 	d := &vp8ldecoder{r: rr}
 	magic, err := d.read(8)
 	if err != nil {
-		return 0, 0, err
+		return 0, 0, false, err
 	}
 	if magic != 0x2f {
-		return 0, 0, errors.New("vp8l: invalid header")
+		return 0, 0, false, errors.New("vp8l: invalid header")
 	}
 	width, err := d.read(14)
 	if err != nil {
-		return 0, 0, err
+		return 0, 0, false, err
 	}
 	width++
 	height, err := d.read(14)
 	if err != nil {
-		return 0, 0, err
+		return 0, 0, false, err
 	}
 	height++
-	_, err = d.read(1) // Read and ignore the hasAlpha hint.
+	alphaHint, err := d.read(1)
 	if err != nil {
-		return 0, 0, err
+		return 0, 0, false, err
 	}
 	version, err := d.read(3)
 	if err != nil {
-		return 0, 0, err
+		return 0, 0, false, err
 	}
 	if version != 0 {
-		return 0, 0, errors.New("vp8l: invalid version")
+		return 0, 0, false, errors.New("vp8l: invalid version")
 	}
-	return int32(width), int32(height), nil
+	return int32(width), int32(height), alphaHint == 1, nil
 }
 
 func readAlpha(chunkData io.Reader, widthMinusOne, heightMinusOne uint32, compression byte) (
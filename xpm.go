@@ -0,0 +1,223 @@
+// XBM and XPM images are C source text. An XBM file defines its dimensions
+// as macros, name_width and name_height, before the array of its bits. An
+// XPM file holds an array of strings, the first of which lists the width,
+// the height, the number of colors and the number of characters per pixel,
+// followed by one string per color. XPM2 files hold the same lines without
+// the C syntax.
+
+package imgsz
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	xpmHeader  = "/* XPM */"
+	xpm2Header = "! XPM2"
+
+	xpmMaxLine      = 4096 // The longest header or color line read.
+	xbmMaxLines     = 64   // The most lines read before the dimensions.
+	xpmMaxColorScan = 1024 // The most colors looked at for transparency.
+)
+
+// xbmSniff reports whether b starts with the definition of the width of an
+// XBM image, so as not to take other C sources for one.
+func xbmSniff(b []byte) bool {
+	b = bytes.TrimLeft(b, " \t\r\n")
+	if i := bytes.IndexByte(b, '\n'); i >= 0 {
+		b = b[:i]
+	}
+	f := bytes.Fields(b)
+	return len(f) == 3 && string(f[0]) == "#define" && bytes.HasSuffix(f[1], []byte("_width"))
+}
+
+// decodexbm returns the dimensions of an XBM image.
+func decodexbm(r io.Reader) (Info, error) {
+	br := bufio.NewReader(r)
+	info := Info{BitDepth: 1, Channels: 1, SampleFormat: SampleUint, ColorModel: ColorGray, Frames: 1}
+	for i := 0; i < xbmMaxLines && (info.Width == 0 || info.Height == 0); i++ {
+		line, err := xpmLine(br)
+		if err != nil {
+			if err == io.EOF {
+				err = FormatError("missing XBM dimensions")
+			}
+			return Info{}, err
+		}
+		f := strings.Fields(line)
+		if len(f) == 0 {
+			continue
+		}
+		if f[0] != "#define" {
+			break
+		}
+		if len(f) != 3 {
+			return Info{}, FormatError("bad XBM definition")
+		}
+		var p *int
+		switch {
+		case f[1] == "width" || strings.HasSuffix(f[1], "_width"):
+			p = &info.Width
+		case f[1] == "height" || strings.HasSuffix(f[1], "_height"):
+			p = &info.Height
+		default:
+			continue
+		}
+		n, err := strconv.ParseUint(f[2], 0, 31)
+		if err != nil || n == 0 {
+			return Info{}, FormatError("bad XBM dimension " + strconv.Quote(f[2]))
+		}
+		*p = int(n)
+	}
+	if info.Width == 0 || info.Height == 0 {
+		return Info{}, FormatError("missing XBM dimensions")
+	}
+	return info, nil
+}
+
+// xpmLine reads a line of at most xpmMaxLine bytes.
+func xpmLine(br *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		b, err := br.ReadSlice('\n')
+		if len(line)+len(b) > xpmMaxLine {
+			return "", FormatError("line too long")
+		}
+		line = append(line, b...)
+		switch {
+		case err == bufio.ErrBufferFull:
+			continue
+		case err == io.EOF && len(line) > 0:
+			return string(line), nil
+		case err != nil:
+			return "", err
+		}
+		return string(line), nil
+	}
+}
+
+// xpmdecoder reads the strings of an XPM file.
+type xpmdecoder struct {
+	r    *bufio.Reader
+	xpm2 bool
+}
+
+// str returns the next string of an XPM file: the next quoted string,
+// comments aside, or the next line of an XPM2 file.
+func (d *xpmdecoder) str() (string, error) {
+	if d.xpm2 {
+		line, err := xpmLine(d.r)
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return strings.TrimRight(line, "\r\n"), err
+	}
+	for {
+		c, err := d.r.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return "", err
+		}
+		switch c {
+		case '"':
+			s, err := d.r.ReadSlice('"')
+			if err == bufio.ErrBufferFull {
+				return "", FormatError("XPM string too long")
+			}
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			if err != nil {
+				return "", err
+			}
+			return string(s[:len(s)-1]), nil
+		case '/':
+			if c, _ := d.r.Peek(1); len(c) == 0 || c[0] != '*' {
+				continue
+			}
+			// Skip the comment, up to "*/".
+			for prev := byte(0); ; {
+				c, err := d.r.ReadByte()
+				if err != nil {
+					if err == io.EOF {
+						err = io.ErrUnexpectedEOF
+					}
+					return "", err
+				}
+				if prev == '*' && c == '/' {
+					break
+				}
+				prev = c
+			}
+		}
+	}
+}
+
+// decodexpm returns the dimensions of an XPM or XPM2 image, and whether one
+// of its colors is transparent.
+func decodexpm(r io.Reader) (Info, error) {
+	d := &xpmdecoder{r: bufio.NewReaderSize(r, xpmMaxLine)}
+	first, err := xpmLine(d.r)
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return Info{}, err
+	}
+	switch strings.TrimSpace(first) {
+	case xpmHeader:
+	case xpm2Header:
+		d.xpm2 = true
+	default:
+		return Info{}, FormatError("missing XPM header")
+	}
+	values, err := d.str()
+	if err != nil {
+		return Info{}, err
+	}
+	f := strings.Fields(values)
+	if len(f) < 4 {
+		return Info{}, FormatError("bad XPM values")
+	}
+	var v [4]int
+	for i := range v {
+		n, err := strconv.ParseUint(f[i], 10, 31)
+		if err != nil || n == 0 {
+			return Info{}, FormatError("bad XPM values")
+		}
+		v[i] = int(n)
+	}
+	info := Info{
+		Size:         Size{v[0], v[1]},
+		BitDepth:     netpbmDepth(v[2] - 1),
+		Channels:     1,
+		SampleFormat: SampleUint,
+		ColorModel:   ColorPalette,
+		Frames:       1,
+	}
+	if info.BitDepth == 0 {
+		info.BitDepth = 1
+	}
+	// Each color line starts with the characters of the pixel, which may be
+	// spaces, followed by pairs of a context key and a color.
+	for i := 0; i < v[2] && i < xpmMaxColorScan && !info.HasAlpha; i++ {
+		s, err := d.str()
+		if err != nil {
+			return Info{}, err
+		}
+		if len(s) < v[3] {
+			return Info{}, FormatError("bad XPM color")
+		}
+		for _, c := range strings.Fields(s[v[3]:]) {
+			if strings.EqualFold(c, "None") {
+				info.HasAlpha = true
+			}
+		}
+	}
+	return info, nil
+}